@@ -0,0 +1,87 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"example.com/m/v2/global"
+	"github.com/golang-jwt/jwt"
+)
+
+// InitAuth 加载 JWT 相关配置并解析所有密钥，active_kid 必须对应一把可以签名的密钥
+func InitAuth() {
+	LoadConfig("auth", global.AUTH_CONFIG)
+
+	conf := global.AUTH_CONFIG
+	for _, keyConf := range conf.Keys {
+		key, err := loadJWTKey(&keyConf)
+		if err != nil {
+			log.Fatalf("Failed to load jwt key %s, got error %v", keyConf.Kid, err)
+		}
+		global.JWT_KEYS[key.Kid] = key
+	}
+
+	active, ok := global.JWT_KEYS[conf.ActiveKid]
+	if !ok || active.SignKey == nil {
+		log.Fatalf("Active jwt key %q is missing or has no private key", conf.ActiveKid)
+	}
+}
+
+// loadJWTKey 根据算法解析一把密钥
+func loadJWTKey(conf *global.AuthKeyConfig) (*global.JWTKey, error) {
+	key := &global.JWTKey{Kid: conf.Kid}
+	switch conf.Alg {
+	case "HS256":
+		if conf.Secret == "" {
+			return nil, errors.New("secret is empty")
+		}
+		if strings.HasPrefix(conf.Secret, placeholderSecret) {
+			return nil, errors.New("secret is still the example value, set a random secret in yaml/auth.yaml")
+		}
+		key.Method = jwt.SigningMethodHS256
+		key.SignKey = []byte(conf.Secret)
+		key.VerifyKey = []byte(conf.Secret)
+	case "RS256":
+		key.Method = jwt.SigningMethodRS256
+		if conf.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(conf.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			if key.SignKey, err = jwt.ParseRSAPrivateKeyFromPEM(pem); err != nil {
+				return nil, err
+			}
+		}
+		pem, err := os.ReadFile(conf.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if key.VerifyKey, err = jwt.ParseRSAPublicKeyFromPEM(pem); err != nil {
+			return nil, err
+		}
+	case "EdDSA":
+		key.Method = jwt.SigningMethodEdDSA
+		if conf.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(conf.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			if key.SignKey, err = jwt.ParseEdPrivateKeyFromPEM(pem); err != nil {
+				return nil, err
+			}
+		}
+		pem, err := os.ReadFile(conf.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if key.VerifyKey, err = jwt.ParseEdPublicKeyFromPEM(pem); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported alg %q", conf.Alg)
+	}
+	return key, nil
+}
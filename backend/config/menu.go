@@ -0,0 +1,35 @@
+package config
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"example.com/m/v2/controller"
+	"example.com/m/v2/global"
+)
+
+// InitMenu 加载菜单配置：时区、营业日分界和热销排行
+func InitMenu() {
+	LoadConfig("menu", global.MENU_CONFIG)
+	location, err := time.LoadLocation(global.MENU_CONFIG.Timezone)
+	if err != nil {
+		log.Fatalf("Invalid timezone %q: %v", global.MENU_CONFIG.Timezone, err)
+	}
+	global.MENU_CONFIG.Location = location
+	if _, err := time.Parse("15:04", global.MENU_CONFIG.BusinessDayStart); err != nil {
+		log.Fatalf("Invalid business_day_start %q", global.MENU_CONFIG.BusinessDayStart)
+	}
+	hot := global.MENU_CONFIG.HotDishes
+	if !slices.Contains(hot.Windows, hot.Window) {
+		log.Fatalf("hot_dishes window %q is not in windows %v", hot.Window, hot.Windows)
+	}
+	for _, window := range hot.Windows {
+		if _, err := controller.ParseWindow(window); err != nil {
+			log.Fatalf("Invalid hot_dishes window %q", window)
+		}
+	}
+	if hot.Limit < 1 || hot.Limit > hot.MaxLimit || hot.RefreshInterval <= 0 {
+		log.Fatalf("Invalid hot_dishes config: %+v", hot)
+	}
+}
@@ -2,11 +2,187 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"example.com/m/v2/controller"
 	"example.com/m/v2/global"
+	"gorm.io/gorm"
 )
 
+// Migration 记录已经执行过的数据迁移
+type Migration struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	AppliedAt time.Time
+}
+
+// dataMigrations 表结构之外、需要且只能执行一次的数据迁移，按顺序执行
+// 已发布的迁移不要修改，新的迁移追加到末尾
+var dataMigrations = []struct {
+	ID  string
+	Run func(tx *gorm.DB) error
+}{
+	{
+		// 角色由 admin 细分为 owner、manager 等，原管理员视为老板，其余为顾客
+		ID: "20261018_roles",
+		Run: func(tx *gorm.DB) error {
+			if err := tx.Model(&controller.User{}).Where("role = ?", "admin").
+				Update("role", controller.RoleOwner).Error; err != nil {
+				return err
+			}
+			return tx.Model(&controller.User{}).Where("role IS NULL OR role = ''").
+				Update("role", controller.RoleCustomer).Error
+		},
+	},
+	{
+		// 金额由整数元改为以分存储
+		ID: "20261018_money_minor_units",
+		Run: func(tx *gorm.DB) error {
+			updates := []string{
+				"UPDATE dishes SET price = price * 100",
+				"UPDATE dish_options SET price_delta = price_delta * 100",
+				"UPDATE records SET price = price * 100",
+				"UPDATE record_options SET price_delta = price_delta * 100",
+				"UPDATE orders SET subtotal = total * 100, total = total * 100, currency = 'CNY'",
+			}
+			for _, sql := range updates {
+				if err := tx.Exec(sql).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		// 分类由文本改为 Category 表：按菜品中出现的先后建立分类，促销、工位路由和菜单中
+		// 只在这些地方出现的分类名排在后面，然后把各表的分类名换成 ID 并删除原来的列
+		ID: "20261018_categories",
+		Run: func(tx *gorm.DB) error {
+			tables := []string{"dishes", "promotions", "station_routes", "menu_items"}
+			sort := 0
+			for _, table := range tables {
+				if !tx.Migrator().HasColumn(table, "category") {
+					continue
+				}
+				var names []string
+				if err := tx.Table(table).Where("category IS NOT NULL AND category <> ''").
+					Group("category").Order("MIN(id)").Pluck("category", &names).Error; err != nil {
+					return err
+				}
+				for _, name := range names {
+					sort++
+					category := controller.Category{Name: name, Sort: sort, Visible: true}
+					if err := tx.Where("name = ?", name).FirstOrCreate(&category).Error; err != nil {
+						return err
+					}
+				}
+			}
+			for _, table := range tables {
+				if !tx.Migrator().HasColumn(table, "category") {
+					continue
+				}
+				sql := "UPDATE " + table + " JOIN categories ON categories.name = " + table + ".category " +
+					"SET " + table + ".category_id = categories.id"
+				if err := tx.Exec(sql).Error; err != nil {
+					return err
+				}
+				if err := tx.Migrator().DropColumn(table, "category"); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		// 引入订单之前的明细没有 order_id，会从订单列表、报表和导出中消失，也不会被清理：
+		// 旧版一次提交的明细时间相同，按时间各建一个已支付的订单，单价取当前菜价
+		ID: "20261018_legacy_records",
+		Run: func(tx *gorm.DB) error {
+			var times []string
+			if err := tx.Model(&controller.Record{}).Where("order_id = 0").
+				Group("time").Order("time").Pluck("time", &times).Error; err != nil {
+				return err
+			}
+			for _, t := range times {
+				createdAt, err := time.ParseInLocation("2006-01-02 15:04:05", t, time.Local)
+				if err != nil {
+					createdAt = time.Now()
+				}
+				order := controller.Order{
+					Status:    controller.OrderStatusPaid,
+					Currency:  "CNY",
+					CreatedAt: createdAt,
+					UpdatedAt: createdAt,
+				}
+				if err := tx.Create(&order).Error; err != nil {
+					return err
+				}
+				if err := tx.Exec("UPDATE records JOIN dishes ON dishes.id = records.dish_id "+
+					"SET records.price = dishes.price WHERE records.order_id = 0 AND records.time = ?", t).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&controller.Record{}).Where("order_id = 0 AND time = ?", t).Updates(map[string]interface{}{
+					"order_id": order.ID,
+					"status":   controller.ItemStatusDone,
+					"done_at":  createdAt,
+				}).Error; err != nil {
+					return err
+				}
+				var subtotal controller.Money
+				if err := tx.Model(&controller.Record{}).Where("order_id = ?", order.ID).
+					Select("COALESCE(SUM(price * count), 0)").Scan(&subtotal).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&order).Updates(map[string]interface{}{
+					"subtotal": subtotal,
+					"total":    subtotal,
+				}).Error; err != nil {
+					return err
+				}
+				if err := tx.Create(&controller.OrderTransition{
+					OrderID:   order.ID,
+					ToStatus:  order.Status,
+					Note:      "旧版明细迁移",
+					CreatedAt: createdAt,
+				}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		// available 列没有数据库默认值（否则 GORM 创建时会忽略 false），AutoMigrate 新增该列时
+		// MySQL 把已有菜品都填为 0；升级前没有上下架，已有的菜品都是上架的
+		ID: "20261018_dish_available",
+		Run: func(tx *gorm.DB) error {
+			return tx.Exec("UPDATE dishes SET available = true").Error
+		},
+	},
+}
+
+// runDataMigrations 依次执行尚未执行的数据迁移，每个迁移及其记录在同一个事务中
+func runDataMigrations() {
+	for _, m := range dataMigrations {
+		var count int64
+		if err := global.DB.Model(&Migration{}).Where("id = ?", m.ID).Count(&count).Error; err != nil {
+			log.Fatalf("Failed to query migration %s, got error %v", m.ID, err)
+		}
+		if count > 0 {
+			continue
+		}
+		err := global.DB.Transaction(func(tx *gorm.DB) error {
+			if err := m.Run(tx); err != nil {
+				return err
+			}
+			return tx.Create(&Migration{ID: m.ID, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			log.Fatalf("Failed to run migration %s, got error %v", m.ID, err)
+		}
+		log.Printf("Migration %s applied\n", m.ID)
+	}
+}
+
 // migrate 是一个泛型函数，用于对指定的数据模型进行数据库自动迁移操作。
 // 自动迁移会根据传入的模型结构体定义，在数据库中创建或更新对应的表结构。
 // 参数 data 是一个指向泛型类型 T 的指针，表示要进行迁移的模型。
@@ -27,7 +203,32 @@ func migrate[T any](data *T) error {
 // 该函数会调用 migrate 函数对指定的模型进行自动迁移操作。
 func InitModel() {
 	// 自动迁移数据库
+	migrate(&controller.Category{})
 	migrate(&controller.Dish{})
+	migrate(&controller.DishOptionGroup{})
+	migrate(&controller.DishOption{})
 	migrate(&controller.Record{})
+	migrate(&controller.RecordOption{})
+	migrate(&controller.Order{})
+	migrate(&controller.OrderTransition{})
+	migrate(&controller.Promotion{})
+	migrate(&controller.OrderPromotion{})
+	migrate(&controller.IdempotencyKey{})
+	migrate(&controller.Table{})
+	migrate(&controller.Station{})
+	migrate(&controller.StationRoute{})
+	migrate(&controller.Menu{})
+	migrate(&controller.MenuWindow{})
+	migrate(&controller.MenuHoliday{})
+	migrate(&controller.MenuItem{})
+	migrate(&controller.Ingredient{})
+	migrate(&controller.RecipeItem{})
+	migrate(&controller.StockMovement{})
 	migrate(&controller.User{})
+	migrate(&controller.RefreshToken{})
+	migrate(&controller.HourlySalesRollup{})
+	migrate(&controller.DailySalesRollup{})
+	migrate(&Migration{})
+
+	runDataMigrations()
 }
@@ -0,0 +1,16 @@
+package config
+
+import (
+	"log"
+
+	"example.com/m/v2/global"
+)
+
+// InitOrder 加载下单相关配置
+func InitOrder() {
+	LoadConfig("order", global.ORDER_CONFIG)
+	conf := global.ORDER_CONFIG
+	if conf.IdempotencyLease <= 0 || conf.IdempotencyLease > conf.IdempotencyWindow {
+		log.Fatalf("Invalid idempotency_lease %v, must be positive and not longer than idempotency_window", conf.IdempotencyLease)
+	}
+}
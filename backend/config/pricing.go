@@ -0,0 +1,15 @@
+package config
+
+import (
+	"log"
+
+	"example.com/m/v2/global"
+)
+
+// InitPricing 加载币种、税率、服务费等计价配置
+func InitPricing() {
+	LoadConfig("pricing", global.PRICING_CONFIG)
+	if len(global.PRICING_CONFIG.Currency) != 3 {
+		log.Fatalf("Invalid currency %q", global.PRICING_CONFIG.Currency)
+	}
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"log"
+
+	"example.com/m/v2/controller"
+	"example.com/m/v2/global"
+)
+
+// InitRetention 加载数据保留策略，检查数据类型、保留时长和归档方式
+func InitRetention() {
+	LoadConfig("retention", global.RETENTION_CONFIG)
+	conf := global.RETENTION_CONFIG
+	if conf.Interval <= 0 || conf.BatchSize <= 0 {
+		log.Fatalf("Invalid retention config: interval %v, batch_size %d", conf.Interval, conf.BatchSize)
+	}
+	for entity, policy := range conf.Policies {
+		if _, ok := controller.RetentionTasks[entity]; !ok {
+			log.Fatalf("Unknown retention entity %q", entity)
+		}
+		if policy.Keep != "" {
+			if _, err := controller.ParseWindow(policy.Keep); err != nil {
+				log.Fatalf("Invalid retention keep %q for %s", policy.Keep, entity)
+			}
+		}
+		switch policy.Archive {
+		case controller.ArchiveFile, controller.ArchiveNone:
+		default:
+			log.Fatalf("Invalid retention archive %q for %s", policy.Archive, entity)
+		}
+	}
+}
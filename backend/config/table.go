@@ -0,0 +1,22 @@
+package config
+
+import (
+	"log"
+	"strings"
+
+	"example.com/m/v2/global"
+)
+
+// placeholderSecret 示例配置中的密钥前缀，使用示例密钥等于公开了密钥
+const placeholderSecret = "change-me"
+
+// InitTable 加载桌号二维码相关配置，未配置签名密钥或仍是示例密钥时无法生成可信的桌号令牌，直接退出
+func InitTable() {
+	LoadConfig("table", global.TABLE_CONFIG)
+	if global.TABLE_CONFIG.Secret == "" {
+		log.Fatalf("table secret is not configured")
+	}
+	if strings.HasPrefix(global.TABLE_CONFIG.Secret, placeholderSecret) {
+		log.Fatalf("table secret is still the example value, set a random secret in yaml/table.yaml")
+	}
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"log"
+
+	"example.com/m/v2/global"
+	"example.com/m/v2/storage"
+)
+
+// InitUpload 加载上传配置并创建文件存储
+func InitUpload() {
+	LoadConfig("upload", global.UPLOAD_CONFIG)
+	conf := global.UPLOAD_CONFIG
+	var err error
+	switch conf.Storage {
+	case "", "local":
+		global.STORAGE, err = storage.NewLocal(conf.Dir, conf.BaseURL)
+	case "s3":
+		s3 := conf.S3
+		global.STORAGE, err = storage.NewS3(s3.Endpoint, s3.AccessKey, s3.SecretKey, s3.Region, s3.Bucket, s3.UseSSL, s3.BaseURL)
+	default:
+		log.Fatalf("Unknown storage %q", conf.Storage)
+	}
+	if err != nil {
+		log.Fatalf("Failed to init storage %q: %v", conf.Storage, err)
+	}
+}
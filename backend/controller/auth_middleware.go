@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ctxUserKey 认证通过后当前用户在 gin.Context 中的键
+const ctxUserKey = "user"
+
+// AuthRequired 校验 Authorization: Bearer <token> 请求头，加载对应用户，
+// 通过后把用户放入 gin.Context，后续处理函数用 CurrentUser 取出，
+// 具体接口的权限由 RequirePermission 检查。
+//
+// 返回值：
+//
+//	gin.HandlerFunc: 中间件，未登录或 token 无效返回 401
+func AuthRequired() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		tokenString, found := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		authenticate(ctx, tokenString, found)
+	}
+}
+
+// StreamAuthRequired 同 AuthRequired，但没有请求头时也接受查询参数 access_token，
+// 只用于 EventSource 和 WebSocket 等浏览器无法设置请求头的推送接口，避免 token 出现在其他接口的访问日志中
+func StreamAuthRequired() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		header := ctx.GetHeader("Authorization")
+		tokenString, found := strings.CutPrefix(header, "Bearer ")
+		if header == "" {
+			tokenString, found = ctx.Query("access_token"), true
+		}
+		authenticate(ctx, tokenString, found)
+	}
+}
+
+// authenticate 校验 token 并加载用户，失败时中止请求
+func authenticate(ctx *gin.Context, tokenString string, found bool) {
+	if !found || tokenString == "" {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "请先登录",
+		})
+		return
+	}
+	claims, err := ParseJWT(tokenString)
+	if err != nil {
+		log.Println()
+		log.Printf("ParseJWT error\n")
+		log.Printf("error: %s\n", err.Error())
+		log.Println()
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "登录已失效，请重新登录",
+		})
+		return
+	}
+
+	var user User
+	if err := global.DB.First(&user, "id = ?", claims.Subject).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "用户不存在",
+			})
+		} else {
+			log.Println()
+			log.Printf("Load user error\n")
+			log.Printf("error: %s\n", err.Error())
+			log.Println()
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "查询用户失败",
+			})
+		}
+		return
+	}
+
+	ctx.Set(ctxUserKey, &user)
+	ctx.Next()
+}
+
+// CurrentUser 返回 AuthRequired 放入 gin.Context 的当前用户，未经过认证时返回 nil
+func CurrentUser(ctx *gin.Context) *User {
+	if user, ok := ctx.Get(ctxUserKey); ok {
+		return user.(*User)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+)
+
+// useJWTKey 在测试期间使用一把 HS256 测试密钥
+func useJWTKey(t *testing.T) {
+	t.Helper()
+	savedKeys, savedConf := global.JWT_KEYS, global.AUTH_CONFIG
+	t.Cleanup(func() { global.JWT_KEYS, global.AUTH_CONFIG = savedKeys, savedConf })
+	secret := []byte("test-secret")
+	global.JWT_KEYS = map[string]*global.JWTKey{
+		"k1": {Kid: "k1", Method: jwt.SigningMethodHS256, SignKey: secret, VerifyKey: secret},
+	}
+	global.AUTH_CONFIG = &global.AuthConfig{
+		Issuer:     "restaurant",
+		AccessTTL:  time.Hour,
+		RefreshTTL: 24 * time.Hour,
+		ActiveKid:  "k1",
+	}
+}
+
+// userRows 查询 users 表时返回的用户
+func userRows(users ...User) fakeResult {
+	rows := make([][]driver.Value, 0, len(users))
+	for _, user := range users {
+		rows = append(rows, []driver.Value{int64(user.ID), user.Username, user.Password, user.Role})
+	}
+	return fakeResult{
+		match:   "FROM `users`",
+		columns: []string{"id", "username", "password", "role"},
+		rows:    rows,
+	}
+}
+
+// bearerToken 为用户签发 token，不带 "Bearer " 前缀
+func bearerToken(t *testing.T, user *User) string {
+	t.Helper()
+	token, err := GenerateJWT(user)
+	if err != nil {
+		t.Fatalf("GenerateJWT() error: %v", err)
+	}
+	return strings.TrimPrefix(token, "Bearer ")
+}
+
+func TestAuthRequired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useJWTKey(t)
+	waiter := &User{ID: 7, Username: "waiter", Role: RoleWaiter}
+	token := bearerToken(t, waiter)
+
+	tests := []struct {
+		name   string
+		header string
+		query  string
+		users  []User
+		stream bool
+		want   int
+	}{
+		{"没有 token", "", "", nil, false, http.StatusUnauthorized},
+		{"不是 Bearer", "Token " + token, "", []User{*waiter}, false, http.StatusUnauthorized},
+		{"token 无效", "Bearer not-a-jwt", "", []User{*waiter}, false, http.StatusUnauthorized},
+		{"用户已删除", "Bearer " + token, "", nil, false, http.StatusUnauthorized},
+		{"通过", "Bearer " + token, "", []User{*waiter}, false, http.StatusOK},
+		{"普通接口不接受 access_token", "", token, []User{*waiter}, false, http.StatusUnauthorized},
+		{"推送接口接受 access_token", "", token, []User{*waiter}, true, http.StatusOK},
+		{"推送接口的 access_token 无效", "", "not-a-jwt", []User{*waiter}, true, http.StatusUnauthorized},
+		{"推送接口优先使用请求头", "Bearer not-a-jwt", token, []User{*waiter}, true, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		useFakeDB(t, userRows(tt.users...))
+		auth := AuthRequired()
+		if tt.stream {
+			auth = StreamAuthRequired()
+		}
+		r := gin.New()
+		r.GET("/", auth, func(ctx *gin.Context) {
+			if user := CurrentUser(ctx); user == nil || user.ID != waiter.ID {
+				t.Errorf("%s: CurrentUser() = %+v, want user %d", tt.name, user, waiter.ID)
+			}
+			ctx.Status(http.StatusOK)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/?access_token="+tt.query, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d, body %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
+
+func TestAccessTokenOnlyForKitchenFeed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useJWTKey(t)
+	// 顾客没有 orders:read，认证通过后返回 403，不会进入推送的长连接
+	customer := &User{ID: 8, Username: "guest", Role: RoleCustomer}
+	useFakeDB(t, userRows(*customer))
+	token := bearerToken(t, customer)
+	r := SetupRouter()
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/kitchen/feed/sse", http.StatusForbidden},
+		{"/kitchen/feed/ws", http.StatusForbidden},
+		{"/kitchen/stations", http.StatusUnauthorized},
+		{"/admin/orders", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path+"?access_token="+token, nil))
+		if w.Code != tt.want {
+			t.Errorf("GET %s?access_token= status = %d, want %d", tt.path, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// CategoryTree 所有分类，用于查分类名、判断可见性和查找子分类
+type CategoryTree struct {
+	categories []Category // 按 Sort、ID 排序
+	byID       map[uint]*Category
+	children   map[uint][]uint
+	position   map[uint]int // 在 categories 中的位置，用于排序菜品
+}
+
+// LoadCategoryTree 加载所有分类
+func LoadCategoryTree(db *gorm.DB) (*CategoryTree, error) {
+	var categories []Category
+	if err := db.Order("sort, id").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	return newCategoryTree(categories), nil
+}
+
+// newCategoryTree 由已按 Sort、ID 排序的分类建立分类树
+func newCategoryTree(categories []Category) *CategoryTree {
+	tree := &CategoryTree{
+		categories: categories,
+		byID:       map[uint]*Category{},
+		children:   map[uint][]uint{},
+		position:   map[uint]int{},
+	}
+	for i := range tree.categories {
+		category := &tree.categories[i]
+		tree.byID[category.ID] = category
+		tree.position[category.ID] = i
+		if category.ParentID != nil {
+			tree.children[*category.ParentID] = append(tree.children[*category.ParentID], category.ID)
+		}
+	}
+	return tree
+}
+
+// Name 返回分类名，未分类或分类不存在时为空
+func (tree *CategoryTree) Name(id uint) string {
+	if category, ok := tree.byID[id]; ok {
+		return category.Name
+	}
+	return ""
+}
+
+// Visible 判断分类及其所有上级分类是否都可见，未分类（0）视为可见
+func (tree *CategoryTree) Visible(id uint) bool {
+	// 限制层数，防止数据中出现环
+	for depth := 0; id != 0 && depth <= len(tree.categories); depth++ {
+		category, ok := tree.byID[id]
+		if !ok {
+			return true
+		}
+		if !category.Visible {
+			return false
+		}
+		if category.ParentID == nil {
+			return true
+		}
+		id = *category.ParentID
+	}
+	return true
+}
+
+// IsAncestor 判断 ancestor 是否为 id 本身或其上级分类
+func (tree *CategoryTree) IsAncestor(ancestor uint, id uint) bool {
+	for _, current := range tree.Lineage(id) {
+		if current == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// Lineage 返回分类本身及其各级上级分类的 ID，由近到远；未分类（0）时为空
+// 按分类配置的促销、工位路由和供应时段都按它查找，设置在上级分类上的对子分类同样生效
+func (tree *CategoryTree) Lineage(id uint) []uint {
+	var ids []uint
+	// 限制层数，防止数据中出现环
+	for depth := 0; id != 0 && depth <= len(tree.categories); depth++ {
+		ids = append(ids, id)
+		category, ok := tree.byID[id]
+		if !ok || category.ParentID == nil {
+			break
+		}
+		id = *category.ParentID
+	}
+	return ids
+}
+
+// WithDescendants 返回分类本身及其所有下级分类的 ID
+func (tree *CategoryTree) WithDescendants(id uint) []uint {
+	ids := []uint{id}
+	seen := map[uint]bool{id: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range tree.children[ids[i]] {
+			if !seen[child] {
+				seen[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids
+}
+
+// VisibleCategories 返回所有可见的分类，按显示顺序排列
+func (tree *CategoryTree) VisibleCategories() []Category {
+	visible := make([]Category, 0, len(tree.categories))
+	for _, category := range tree.categories {
+		if tree.Visible(category.ID) {
+			visible = append(visible, category)
+		}
+	}
+	return visible
+}
+
+// SortDishes 按分类的显示顺序、分类内的顺序排列菜品，未分类的菜品排在最后
+func (tree *CategoryTree) SortDishes(dishes []Dish) {
+	rank := func(dish *Dish) int {
+		if position, ok := tree.position[dish.CategoryID]; ok {
+			return position
+		}
+		return len(tree.categories)
+	}
+	sort.SliceStable(dishes, func(i, j int) bool {
+		ri, rj := rank(&dishes[i]), rank(&dishes[j])
+		if ri != rj {
+			return ri < rj
+		}
+		if dishes[i].Sort != dishes[j].Sort {
+			return dishes[i].Sort < dishes[j].Sort
+		}
+		return dishes[i].ID < dishes[j].ID
+	})
+}
@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errCategoryNotEmpty = errors.New("category not empty")
+
+// checkDishCategory 校验菜品的分类存在，0 表示未分类
+func checkDishCategory(ctx *gin.Context, categoryID uint) bool {
+	if categoryID == 0 {
+		return true
+	}
+	var count int64
+	if err := global.DB.Model(&Category{}).Where("id = ?", categoryID).Count(&count).Error; err != nil || count == 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": "分类不存在",
+		})
+		return false
+	}
+	return true
+}
+
+// checkCategoryParent 校验上级分类存在，且不是分类自身或其下级分类
+func checkCategoryParent(ctx *gin.Context, category *Category) bool {
+	if category.ParentID == nil {
+		return true
+	}
+	categories, err := LoadCategoryTree(global.DB)
+	msg := ""
+	switch {
+	case err != nil:
+		msg = "查询分类失败"
+	case categories.Name(*category.ParentID) == "":
+		msg = "上级分类不存在"
+	case category.ID != 0 && categories.IsAncestor(category.ID, *category.ParentID):
+		msg = "上级分类不能是自身或下级分类"
+	}
+	if msg != "" {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": msg,
+		})
+		return false
+	}
+	return true
+}
+
+// GetCategories 获取顾客可见的分类，按显示顺序排列，子分类通过 ParentID 关联
+func GetCategories(ctx *gin.Context) {
+	categories, err := LoadCategoryTree(global.DB)
+	if err != nil {
+		log.Println()
+		log.Printf("Load categories error\n")
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询分类失败",
+		})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, categories.VisibleCategories())
+}
+
+// GetAllCategories 获取所有分类，包括隐藏的，供后台使用
+func GetAllCategories(ctx *gin.Context) {
+	categories, err := LoadCategoryTree(global.DB)
+	if err != nil {
+		log.Println()
+		log.Printf("Load categories error\n")
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询分类失败",
+		})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, categories.categories)
+}
+
+// AddCategory 添加分类，未提供 Visible 时默认显示
+func AddCategory(ctx *gin.Context) {
+	category := Category{Visible: true}
+	if ok := BindJSON(ctx, &category); !ok {
+		return
+	}
+	category.ID = 0
+	if ok := checkCategoryParent(ctx, &category); !ok {
+		return
+	}
+	if ok := CreateDataWithoutBind(ctx, &category); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, category)
+}
+
+// UpdateCategory 更新分类，Visible 为 false、ParentID 为空时也会写入
+func UpdateCategory(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var category Category
+	if ok := GetData(ctx, &category, map[string]interface{}{"id": id}); !ok {
+		return
+	}
+	categoryID := category.ID
+	if ok := BindJSON(ctx, &category); !ok {
+		return
+	}
+	category.ID = categoryID
+	if ok := checkCategoryParent(ctx, &category); !ok {
+		return
+	}
+	if err := global.DB.Select("name", "sort", "icon", "visible", "parent_id").Updates(&category).Error; err != nil {
+		log.Println()
+		log.Printf("Update category error\n")
+		log.Printf("category: %+v\n", category)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "更新失败",
+		})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, category)
+}
+
+// DeleteCategory 删除分类，仍有菜品或子分类时拒绝删除
+func DeleteCategory(ctx *gin.Context) {
+	id := ctx.Param("id")
+	iid, _ := strconv.Atoi(id)
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		var dishes, children int64
+		if err := tx.Model(&Dish{}).Where("category_id = ?", iid).Count(&dishes).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Category{}).Where("parent_id = ?", iid).Count(&children).Error; err != nil {
+			return err
+		}
+		if dishes > 0 || children > 0 {
+			return errCategoryNotEmpty
+		}
+		// 促销、工位路由和菜单中指向该分类的设置一并删除，避免变成适用于全部菜品
+		for _, model := range []interface{}{&StationRoute{}, &MenuItem{}} {
+			if err := tx.Where("category_id = ?", iid).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&Promotion{}).Where("category_id = ?", iid).Update("active", false).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Category{ID: uint(iid)}).Error
+	})
+	if err != nil {
+		log.Println()
+		log.Printf("Delete category error\n")
+		log.Printf("category: %s\n", id)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		if errors.Is(err, errCategoryNotEmpty) {
+			ctx.IndentedJSON(http.StatusConflict, gin.H{
+				"error": "分类下还有菜品或子分类，请先移走",
+			})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+				"error": "删除错误",
+			})
+		}
+		return
+	}
+	log.Println()
+	log.Printf("Delete category: %s\n", id)
+	ctx.IndentedJSON(http.StatusNoContent, nil)
+}
+
+// ReorderCategories 拖拽排序分类，请求体为按新顺序排列的分类 ID，Sort 依次设为 1、2、3……
+func ReorderCategories(ctx *gin.Context) {
+	var ids []uint
+	if ok := BindJSON(ctx, &ids); !ok {
+		return
+	}
+	reorder(ctx, &Category{}, ids, nil)
+}
+
+// ReorderDishes 拖拽排序分类内的菜品，请求体为按新顺序排列的菜品 ID，必须都属于该分类
+func ReorderDishes(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var category Category
+	if ok := GetData(ctx, &category, map[string]interface{}{"id": id}); !ok {
+		return
+	}
+	var ids []uint
+	if ok := BindJSON(ctx, &ids); !ok {
+		return
+	}
+	reorder(ctx, &Dish{}, ids, map[string]interface{}{"category_id": category.ID})
+}
+
+// reorder 按 ids 的顺序设置 Sort，ids 中的记录都必须存在且满足 scope 条件
+func reorder(ctx *gin.Context, model interface{}, ids []uint, scope map[string]interface{}) {
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+				"error": "ID 重复",
+			})
+			return
+		}
+		seen[id] = true
+	}
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		query := tx.Model(model).Where("id IN ?", ids)
+		if scope != nil {
+			query = query.Where(scope)
+		}
+		if err := query.Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(ids) {
+			return gorm.ErrRecordNotFound
+		}
+		for i, id := range ids {
+			if err := tx.Model(model).Where("id = ?", id).Update("sort", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println()
+		log.Printf("Reorder error\n")
+		log.Printf("ids: %v, scope: %v\n", ids, scope)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+				"error": "存在不存在或不属于该分类的 ID",
+			})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+				"error": "排序失败",
+			})
+		}
+		return
+	}
+	ctx.IndentedJSON(http.StatusNoContent, nil)
+}
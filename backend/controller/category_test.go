@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCategoryTree(t *testing.T) {
+	ptr := func(id uint) *uint { return &id }
+	tree := newCategoryTree([]Category{
+		{ID: 1, Name: "主食", Visible: true},
+		{ID: 2, Name: "面", Visible: true, ParentID: ptr(1)},
+		{ID: 3, Name: "拌面", Visible: true, ParentID: ptr(2)},
+		{ID: 4, Name: "季节限定", Visible: false},
+		{ID: 5, Name: "秋季", Visible: true, ParentID: ptr(4)},
+		// 数据中出现环时不能死循环
+		{ID: 6, Name: "环A", Visible: true, ParentID: ptr(7)},
+		{ID: 7, Name: "环B", Visible: true, ParentID: ptr(6)},
+	})
+
+	visible := []struct {
+		id   uint
+		want bool
+	}{
+		{0, true}, // 未分类
+		{1, true},
+		{3, true},
+		{4, false},
+		{5, false}, // 上级分类隐藏
+		{99, true}, // 分类已删除
+		{6, true},
+	}
+	for _, tt := range visible {
+		if got := tree.Visible(tt.id); got != tt.want {
+			t.Errorf("Visible(%d) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+
+	ancestors := []struct {
+		ancestor, id uint
+		want         bool
+	}{
+		{3, 3, true},
+		{2, 3, true},
+		{1, 3, true},
+		{3, 1, false},
+		{4, 3, false},
+		{1, 0, false},
+		{1, 99, false},
+		{7, 6, true},
+		{1, 6, false},
+	}
+	for _, tt := range ancestors {
+		if got := tree.IsAncestor(tt.ancestor, tt.id); got != tt.want {
+			t.Errorf("IsAncestor(%d, %d) = %v, want %v", tt.ancestor, tt.id, got, tt.want)
+		}
+	}
+
+	if got := tree.Lineage(3); !slices.Equal(got, []uint{3, 2, 1}) {
+		t.Errorf("Lineage(3) = %v, want [3 2 1]", got)
+	}
+	if got := tree.Lineage(0); len(got) != 0 {
+		t.Errorf("Lineage(0) = %v, want empty", got)
+	}
+	if got := tree.WithDescendants(1); !slices.Equal(got, []uint{1, 2, 3}) {
+		t.Errorf("WithDescendants(1) = %v, want [1 2 3]", got)
+	}
+	if got := len(tree.VisibleCategories()); got != 5 {
+		t.Errorf("VisibleCategories() returned %d categories, want 5", got)
+	}
+}
+
+func TestCategoryTreeSortDishes(t *testing.T) {
+	tree := newCategoryTree([]Category{
+		{ID: 2, Name: "热菜", Sort: 1},
+		{ID: 1, Name: "凉菜", Sort: 2},
+	})
+	dishes := []Dish{
+		{ID: 1, CategoryID: 1},
+		{ID: 2, CategoryID: 0},
+		{ID: 3, CategoryID: 2, Sort: 2},
+		{ID: 4, CategoryID: 2, Sort: 1},
+		{ID: 5, CategoryID: 1},
+	}
+	tree.SortDishes(dishes)
+	got := make([]uint, 0, len(dishes))
+	for _, dish := range dishes {
+		got = append(got, dish.ID)
+	}
+	if want := []uint{4, 3, 1, 5, 2}; !slices.Equal(got, want) {
+		t.Errorf("SortDishes() order = %v, want %v", got, want)
+	}
+}
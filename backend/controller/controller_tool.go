@@ -1,9 +1,14 @@
 package controller
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"example.com/m/v2/global"
@@ -97,6 +102,7 @@ func CreateDataWithoutBind[T any](ctx *gin.Context, data *T) bool {
 //	ctx *gin.Context: gin框架的上下文对象，用于处理HTTP请求和响应
 //	data *T: 一个指向泛型类型的指针，用于存储从数据库中获取的数据
 //	query map[string]interface{}: 一个map类型的变量，用于指定查询条件
+//	preloads ...string: 需要预加载的关联字段
 //
 // 返回值：
 //
@@ -106,11 +112,15 @@ func CreateDataWithoutBind[T any](ctx *gin.Context, data *T) bool {
 //
 //	如果查询到的记录不存在，函数会以HTTP状态码404返回错误信息和查询条件；
 //	如果查询过程中出现其他错误，函数会以HTTP状态码500返回错误信息和查询条件。
-func GetData[T any](ctx *gin.Context, data *T, query map[string]interface{}) bool {
+func GetData[T any](ctx *gin.Context, data *T, query map[string]interface{}, preloads ...string) bool {
 	// 这里query map[string]interface{}
 	// 不能使用type DataQuery map[string]interface{}
 	// 会无法识别
-	if err := global.DB.Where(query).First(data).Error; err != nil {
+	db := global.DB
+	for _, preload := range preloads {
+		db = db.Preload(preload)
+	}
+	if err := db.Where(query).First(data).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			log.Println()
 			log.Printf("Record not found\n")
@@ -144,11 +154,16 @@ func GetData[T any](ctx *gin.Context, data *T, query map[string]interface{}) boo
 // ctx: *gin.Context - gin框架的上下文对象，用于处理HTTP请求和响应。
 // datas: *[]T - 指向切片类型的指针，用于存储查询结果。T为泛型类型，表示切片中元素的类型。
 // query: map[string]interface{} - 查询条件，用于筛选数据库中的数据。
+// preloads: ...string - 需要预加载的关联字段。
 //
 // 返回值：
 // bool - 如果查询过程中发生错误，则返回错误false；否则返回true。
-func GetAllDatas[T any](ctx *gin.Context, datas *[]T, query map[string]interface{}) bool {
-	if err := global.DB.Where(query).Find(datas).Error; err != nil {
+func GetAllDatas[T any](ctx *gin.Context, datas *[]T, query map[string]interface{}, preloads ...string) bool {
+	db := global.DB
+	for _, preload := range preloads {
+		db = db.Preload(preload)
+	}
+	if err := db.Where(query).Find(datas).Error; err != nil {
 		log.Println()
 		log.Printf("Query All error\n")
 		log.Printf("query: %v\n", query)
@@ -242,6 +257,31 @@ func DeleteData[T any](ctx *gin.Context, data *T) bool {
 	return true
 }
 
+// GetPagination 从查询参数 page、page_size 中解析分页信息
+//
+// 参数:
+//
+//	ctx *gin.Context: gin 框架的上下文对象
+//
+// 返回值:
+//
+//	page int: 页码，从1开始，默认1
+//	size int: 每页条数，默认20，最大100
+func GetPagination(ctx *gin.Context) (page int, size int) {
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	size, err = strconv.Atoi(ctx.DefaultQuery("page_size", "20"))
+	if err != nil || size < 1 {
+		size = 20
+	}
+	if size > 100 {
+		size = 100
+	}
+	return page, size
+}
+
 // BindJSON 是一个泛型函数，用于将传入的 JSON 数据绑定到指定的结构体指针中。
 // 参数 ctx 是 gin 框架的上下文对象，data 是要绑定的结构体指针。
 // 如果绑定成功，函数返回true；如果绑定失败，函数将返回false。
@@ -287,27 +327,98 @@ func CheckPassword(data *string, hash *string) bool {
 	return true
 }
 
-func GenerateJWT(username *string) (string, error) {
-	// 生成token
-	// claims := jwt.StandardClaims{}
-	/*
-		Audience  string `json:"aud,omitempty"`
-		ExpiresAt int64  `json:"exp,omitempty"`
-		Id        string `json:"jti,omitempty"`
-		IssuedAt  int64  `json:"iat,omitempty"`
-		Issuer    string `json:"iss,omitempty"`
-		NotBefore int64  `json:"nbf,omitempty"`
-		Subject   string `json:"sub,omitempty"`
-	*/
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
-		"username": username,
-		"nbf":      time.Now().Unix(),
-		"exp":      time.Now().Add(time.Hour * 2).Unix(),
-		"update":   time.Now().Add(time.Minute * 90).Unix(),
+// AccessClaims access token 中的声明，Subject 为用户 ID
+type AccessClaims struct {
+	jwt.StandardClaims
+	Username string `json:"username"`
+}
+
+// GenerateJWT 使用 active_kid 对应的密钥为用户签发 access token，并在头部写入 kid
+//
+// 参数:
+//
+//	user *User: 要签发 token 的用户
+//
+// 返回值:
+//
+//	string: 带 "Bearer " 前缀的 token
+//	error: 签名失败时返回错误
+func GenerateJWT(user *User) (string, error) {
+	conf := global.AUTH_CONFIG
+	key, ok := global.JWT_KEYS[conf.ActiveKid]
+	if !ok {
+		return "", errors.New("active jwt key not found: " + conf.ActiveKid)
+	}
+	now := time.Now()
+	token := jwt.NewWithClaims(key.Method, AccessClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			Issuer:    conf.Issuer,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(conf.AccessTTL).Unix(),
+		},
+		Username: user.Username,
 	})
+	// 校验时根据 kid 找到对应的密钥，轮换期间新旧密钥签发的 token 都有效
+	token.Header["kid"] = key.Kid
 	// 加密
-	signKey := []byte("secret")
-	signedToken, err := token.SignedString(signKey)
+	signedToken, err := token.SignedString(key.SignKey)
 	signedToken = "Bearer " + signedToken
 	return signedToken, err
 }
+
+// ParseJWT 根据 kid 找到密钥，校验 token 的签名算法、签名、签发者和有效期
+//
+// 参数:
+//
+//	tokenString string: 不带 "Bearer " 前缀的 token
+//
+// 返回值:
+//
+//	*AccessClaims: token 中的声明
+//	error: 校验失败时返回错误
+func ParseJWT(tokenString string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := global.JWT_KEYS[kid]
+		if !ok {
+			return nil, errors.New("unknown kid: " + kid)
+		}
+		// 必须校验算法，防止 alg 被篡改为 none 或用公钥当 HMAC 密钥
+		if token.Method != key.Method {
+			return nil, errors.New("unexpected signing method: " + token.Method.Alg())
+		}
+		return key.VerifyKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || !claims.VerifyIssuer(global.AUTH_CONFIG.Issuer, true) {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// GenerateRefreshToken 生成一个随机的 refresh token，数据库中只保存它的哈希
+//
+// 返回值:
+//
+//	token string: 返回给客户端的 refresh token
+//	hash string: 保存到数据库的哈希
+//	err error: 随机数生成失败时返回错误
+func GenerateRefreshToken() (token string, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err = rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken 计算 refresh token 的哈希
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"example.com/m/v2/global"
+	"github.com/golang-jwt/jwt"
+)
+
+// signToken 用指定的算法、密钥和 kid 签发 token
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims AccessClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString() error: %v", err)
+	}
+	return signed
+}
+
+func TestParseJWT(t *testing.T) {
+	useJWTKey(t)
+	secret := []byte("test-secret")
+	now := time.Now()
+	claims := func(issuer string, expiresAt time.Time) AccessClaims {
+		return AccessClaims{StandardClaims: jwt.StandardClaims{
+			Subject:   "7",
+			Issuer:    issuer,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: expiresAt.Unix(),
+		}}
+	}
+	valid := claims("restaurant", now.Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"有效", signToken(t, jwt.SigningMethodHS256, secret, "k1", valid), false},
+		{"未知的 kid", signToken(t, jwt.SigningMethodHS256, secret, "k2", valid), true},
+		{"没有 kid", signToken(t, jwt.SigningMethodHS256, secret, "", valid), true},
+		{"算法不符", signToken(t, jwt.SigningMethodHS384, secret, "k1", valid), true},
+		{"alg 为 none", signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "k1", valid), true},
+		{"签名不符", signToken(t, jwt.SigningMethodHS256, []byte("other-secret"), "k1", valid), true},
+		{"签发者不符", signToken(t, jwt.SigningMethodHS256, secret, "k1", claims("someone-else", now.Add(time.Hour))), true},
+		{"没有签发者", signToken(t, jwt.SigningMethodHS256, secret, "k1", claims("", now.Add(time.Hour))), true},
+		{"已过期", signToken(t, jwt.SigningMethodHS256, secret, "k1", claims("restaurant", now.Add(-time.Minute))), true},
+		{"格式错误", "not-a-jwt", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseJWT(tt.token)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: ParseJWT() = %+v, want error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got.Subject != "7" {
+			t.Errorf("%s: ParseJWT() = %+v, %v; want subject 7", tt.name, got, err)
+		}
+	}
+}
+
+func TestGenerateJWT(t *testing.T) {
+	useJWTKey(t)
+	token, err := GenerateJWT(&User{ID: 7, Username: "waiter"})
+	if err != nil {
+		t.Fatalf("GenerateJWT() error: %v", err)
+	}
+	claims, err := ParseJWT(token[len("Bearer "):])
+	if err != nil {
+		t.Fatalf("ParseJWT(GenerateJWT()) error: %v", err)
+	}
+	if claims.Subject != "7" || claims.Username != "waiter" || claims.Issuer != "restaurant" {
+		t.Errorf("claims = %+v, want subject 7, username waiter, issuer restaurant", claims)
+	}
+
+	// active_kid 没有对应的密钥时不能签发
+	useJWTKey(t)
+	delete(global.JWT_KEYS, "k1")
+	if _, err := GenerateJWT(&User{ID: 7}); err == nil {
+		t.Error("GenerateJWT() without active key, want error")
+	}
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"example.com/m/v2/global"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeDB 测试用的数据库：按 SQL 片段返回预设的结果，并记录执行过的语句和事务
+type fakeDB struct {
+	mu        sync.Mutex
+	results   []fakeResult
+	stmts     []fakeStmt
+	commits   int
+	rollbacks int
+	lastID    int64
+}
+
+// fakeResult 第一个 match 出现在 SQL 中的结果生效，没有匹配时查询返回空、写入影响 1 行
+type fakeResult struct {
+	match   string
+	columns []string
+	rows    [][]driver.Value
+	err     error
+}
+
+// fakeStmt 执行过的一条语句
+type fakeStmt struct {
+	SQL  string
+	Args []driver.Value
+}
+
+// useFakeDB 在测试期间用 fakeDB 替换 global.DB
+func useFakeDB(t *testing.T, results ...fakeResult) *fakeDB {
+	t.Helper()
+	fake := &fakeDB{results: results}
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sql.OpenDB(fake),
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open fake db: %v", err)
+	}
+	saved := global.DB
+	t.Cleanup(func() { global.DB = saved })
+	global.DB = db
+	return fake
+}
+
+// Executed 返回包含 match 的语句
+func (f *fakeDB) Executed(match string) []fakeStmt {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var stmts []fakeStmt
+	for _, stmt := range f.stmts {
+		if strings.Contains(stmt.SQL, match) {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
+
+func (f *fakeDB) run(query string, args []driver.NamedValue) fakeResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	values := make([]driver.Value, 0, len(args))
+	for _, arg := range args {
+		values = append(values, arg.Value)
+	}
+	f.stmts = append(f.stmts, fakeStmt{SQL: query, Args: values})
+	for _, result := range f.results {
+		if strings.Contains(query, result.match) {
+			return result
+		}
+	}
+	return fakeResult{}
+}
+
+// 以下实现 database/sql/driver 接口
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepare not supported: %s", query)
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.commits++
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.rollbacks++
+	return nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result := c.db.run(query, args)
+	if result.err != nil {
+		return nil, result.err
+	}
+	return &fakeRows{columns: result.columns, rows: result.rows}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result := c.db.run(query, args)
+	if result.err != nil {
+		return nil, result.err
+	}
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.lastID++
+	return fakeExecResult(c.db.lastID), nil
+}
+
+// fakeExecResult 每次写入影响 1 行，自增 ID 依次递增
+type fakeExecResult int64
+
+func (r fakeExecResult) LastInsertId() (int64, error) { return int64(r), nil }
+func (r fakeExecResult) RowsAffected() (int64, error) { return 1, nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -1,14 +1,20 @@
 package controller
 
 import (
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
+	"example.com/m/v2/global"
 	"github.com/gin-gonic/gin"
 )
 
-// AddDish 函数用于处理添加菜品的请求
+// AddDish 函数用于处理添加菜品的请求，未提供 Available 时默认上架
 //
 // 参数:
 //
@@ -18,8 +24,18 @@ import (
 //
 //	无
 func AddDish(ctx *gin.Context) {
-	var dish Dish
-	if ok := CreateData(ctx, &dish); !ok {
+	dish := Dish{Available: true}
+	if ok := BindJSON(ctx, &dish); !ok {
+		return
+	}
+	if ok := checkDishCategory(ctx, dish.CategoryID); !ok {
+		return
+	}
+	if ok := checkOptionGroups(ctx, &dish); !ok {
+		return
+	}
+	initDishStock(&dish, true)
+	if ok := CreateDataWithoutBind(ctx, &dish); !ok {
 		return
 	}
 
@@ -35,13 +51,16 @@ func AddDish(ctx *gin.Context) {
 //
 //	无
 func GetDish(ctx *gin.Context) {
+	resetDailyStock()
 	id := ctx.Param("id")
 	var dish Dish
 	query := map[string]interface{}{"id": id}
-	if ok := GetData(ctx, &dish, query); !ok {
+	if ok := GetData(ctx, &dish, query, "OptionGroups.Options"); !ok {
 		return
 	}
-	ctx.IndentedJSON(http.StatusOK, dish)
+	dishes := []Dish{dish}
+	markIngredientShortages(dishes)
+	ctx.IndentedJSON(http.StatusOK, dishes[0])
 }
 
 // UpdateDish 更新菜品信息
@@ -56,9 +75,45 @@ func GetDish(ctx *gin.Context) {
 //	无
 func UpdateDish(ctx *gin.Context) {
 	var dish Dish
-	if ok := UpdateData(ctx, &dish); !ok {
+	if ok := BindJSON(ctx, &dish); !ok {
+		return
+	}
+	if ok := checkDishCategory(ctx, dish.CategoryID); !ok {
+		return
+	}
+	if ok := checkOptionGroups(ctx, &dish); !ok {
+		return
+	}
+	// 修改每日份数时今日剩余同时重置，和 UpdateDishAvailability 一致
+	stockEdited := dish.DailyStock != 0 || dish.Stock != 0
+	if stockEdited {
+		resetDailyStock()
+		var current Dish
+		if err := global.DB.Select("id", "daily_stock").First(&current, dish.ID).Error; err != nil {
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{
+				"error": "菜品不存在",
+			})
+			return
+		}
+		initDishStock(&dish, dish.DailyStock != current.DailyStock)
+	}
+	if err := global.DB.Model(&dish).Updates(&dish).Error; err != nil {
+		log.Println()
+		log.Printf("Update dish error\n")
+		log.Printf("dish: %+v\n", dish)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "更新失败",
+		})
 		return
 	}
+	// 补充库存后自动解除售罄
+	if stockEdited && dish.Stock > 0 {
+		if err := global.DB.Model(&dish).Update("sold_out", false).Error; err != nil {
+			log.Printf("Update dish sold out error: %v\n", err)
+		}
+	}
 	// var new_dish Dish
 	// GetData(ctx, &new_dish, DataQuery{"id": dish.ID})
 	// ctx.IndentedJSON(http.StatusOK, new_dish)
@@ -92,7 +147,7 @@ func DeleteDish(ctx *gin.Context) {
 	ctx.IndentedJSON(http.StatusNoContent, nil)
 }
 
-// GetAllDishes 函数用于获取所有菜品信息
+// GetAllDishes 函数用于获取当前供应时段内的所有菜品信息
 //
 // 参数：
 //   - ctx *gin.Context：Gin框架的上下文对象
@@ -101,105 +156,334 @@ func DeleteDish(ctx *gin.Context) {
 //
 //	无返回值
 func GetAllDishes(ctx *gin.Context) {
+	resetDailyStock()
 	var dishes []Dish
-	if ok := GetAllDatas(ctx, &dishes, nil); !ok {
+	if ok := GetAllDatas(ctx, &dishes, nil, "OptionGroups.Options"); !ok {
+		return
+	}
+	dishes, categories, ok := presentDishes(ctx, dishes)
+	if !ok {
 		return
 	}
+	categories.SortDishes(dishes)
 	ctx.IndentedJSON(http.StatusOK, dishes)
 }
 
-// GetDishesByCategory 函数根据传入的分类获取对应的菜品列表
+// GetDishesByCategory 函数根据传入的分类获取当前供应时段内对应的菜品列表，包括子分类的菜品
 // 参数：
 //
-//	ctx: *gin.Context - gin框架的上下文对象
+//	ctx: *gin.Context - gin框架的上下文对象，路径参数 category 为分类 ID，也兼容分类名
 //
 // 返回值：
 //
 //	无
 func GetDishesByCategory(ctx *gin.Context) {
-	category := ctx.Param("category")
+	resetDailyStock()
+	var category Category
+	if id, err := strconv.ParseUint(ctx.Param("category"), 10, 64); err == nil {
+		category.ID = uint(id)
+	} else if err := global.DB.Where("name = ?", ctx.Param("category")).First(&category).Error; err != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{
+			"error": "分类不存在",
+		})
+		return
+	}
+	categories, err := LoadCategoryTree(global.DB)
 	var dishes []Dish
-	query := map[string]interface{}{"category": category}
-	if ok := GetAllDatas(ctx, &dishes, query); !ok {
+	if err == nil {
+		err = global.DB.Preload("OptionGroups.Options").
+			Where("category_id IN ?", categories.WithDescendants(category.ID)).
+			Find(&dishes).Error
+	}
+	if err != nil {
+		log.Println()
+		log.Printf("Query dishes by category error\n")
+		log.Printf("category: %s\n", ctx.Param("category"))
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询菜品失败",
+		})
+		return
+	}
+	dishes, categories, ok := presentDishes(ctx, dishes)
+	if !ok {
 		return
 	}
+	categories.SortDishes(dishes)
 	ctx.IndentedJSON(http.StatusOK, dishes)
 }
 
+// GetHotDishes 返回热销菜品，只包含顾客当前能看到且可点的菜品
+//
+// 参数：
+//
+//	ctx *gin.Context: Gin 框架的上下文对象，查询参数：
+//	window 统计窗口（yaml/menu.yaml 中 windows 之一，如 7d、24h）、limit 返回数量、category 分类 ID 或名称（含子分类），默认值见 yaml/menu.yaml
+//
+// 返回值：
+//
+//	无返回值，返回按热度排序的菜品列表
+//
+// 备注：
+//
+//	排行由后台定时统计并缓存，售罄、下架和隐藏在每次请求时过滤
 func GetHotDishes(ctx *gin.Context) {
-	// 获取所有record
-	var records []Record
-	if ok := GetAllDatas(ctx, &records, nil); !ok {
-		return
-	}
-	// 统计每个dish的count
-	dish_count := make(map[uint]int)
-	for _, record := range records {
-		dish_count[record.DishID] += record.Count
-	}
-	// 实现算法，获取map中value最大的前6个key
-	// 用一个数组动态维护前6个key
-	max_ids := make([]uint, 6)
-	for id, cnt := range dish_count {
-		for i := 0; i < 6; i++ {
-			if dish_count[max_ids[i]] < cnt {
-				// 其他元素往后移动
-				for j := 5; j > i; j-- {
-					max_ids[j] = max_ids[j-1]
-				}
-				// 插入到第i个位置
-				max_ids[i] = id
-				break // 插入成功，跳出循环
+	conf := global.MENU_CONFIG.HotDishes
+	// 只接受配置的窗口，否则任意时长都会新增一份缓存和一次统计
+	value := ctx.DefaultQuery("window", conf.Window)
+	if !slices.Contains(conf.Windows, value) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("window 只能为 %s", strings.Join(conf.Windows, "、")),
+		})
+		return
+	}
+	window, _ := ParseWindow(value)
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(conf.Limit)))
+	if err != nil || limit < 1 || limit > conf.MaxLimit {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("limit 应在 1 到 %d 之间", conf.MaxLimit),
+		})
+		return
+	}
+	var scope map[uint]bool
+	if value := ctx.Query("category"); value != "" {
+		categoryIDs, ok := categoryScope(ctx, value)
+		if !ok {
+			return
+		}
+		scope = categoryIDs
+	}
+
+	resetDailyStock()
+	ranking, err := HotDishRanking(window)
+	if err != nil {
+		log.Println()
+		log.Printf("Rank hot dishes error\n")
+		log.Printf("window: %v\n", window)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询热销菜品失败",
+		})
+		return
+	}
+	dishes := []Dish{}
+	if len(ranking) > 0 {
+		if ok := GetManyDatas(ctx, &dishes, "id IN ?", ranking); !ok {
+			return
+		}
+	}
+	dishes, _, ok := presentDishes(ctx, dishes)
+	if !ok {
+		return
+	}
+	byID := make(map[uint]Dish, len(dishes))
+	for _, dish := range dishes {
+		if dish.Available && !dish.SoldOut && (scope == nil || scope[dish.CategoryID]) {
+			byID[dish.ID] = dish
+		}
+	}
+	hot := make([]Dish, 0, limit)
+	for _, id := range ranking {
+		if dish, ok := byID[id]; ok {
+			hot = append(hot, dish)
+			if len(hot) == limit {
+				break
+			}
+		}
+	}
+	ctx.IndentedJSON(http.StatusOK, hot)
+}
+
+// categoryScope 返回分类（ID 或名称）及其子分类的 ID 集合，失败时已写入错误响应
+func categoryScope(ctx *gin.Context, value string) (map[uint]bool, bool) {
+	var category Category
+	if id, err := strconv.ParseUint(value, 10, 64); err == nil {
+		category.ID = uint(id)
+	} else if err := global.DB.Where("name = ?", value).First(&category).Error; err != nil {
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{
+			"error": "分类不存在",
+		})
+		return nil, false
+	}
+	categories, err := LoadCategoryTree(global.DB)
+	if err != nil {
+		log.Printf("Load categories error: %v\n", err)
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询分类失败",
+		})
+		return nil, false
+	}
+	scope := map[uint]bool{}
+	for _, id := range categories.WithDescendants(category.ID) {
+		scope[id] = true
+	}
+	return scope, true
+}
+
+// SearchDishes 按关键词搜索当前供应时段内的菜品，支持菜名、拼音和拼音首字母（如 hgr 匹配回锅肉）
+//
+// 参数：
+//
+//	ctx *gin.Context: Gin 框架的上下文对象，查询参数：
+//	q 关键词（必填）、category 分类 ID 或名称（含子分类）、min_price/max_price 价格区间（分）、
+//	available=true 只返回可点的菜品、page/page_size 分页
+//
+// 返回值：
+//
+//	无返回值，返回 {"total", "dishes"}，按匹配度排序，热销的菜品靠前
+func SearchDishes(ctx *gin.Context) {
+	query := strings.TrimSpace(ctx.Query("q"))
+	if query == "" {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": "请输入搜索关键词",
+		})
+		return
+	}
+	var minPrice, maxPrice int64 = 0, math.MaxInt64
+	for param, bound := range map[string]*int64{"min_price": &minPrice, "max_price": &maxPrice} {
+		if value := ctx.Query(param); value != "" {
+			price, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || price < 0 {
+				ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+					"error": "价格区间无效",
+				})
+				return
 			}
+			*bound = price
+		}
+	}
+	resetDailyStock()
+
+	db := global.DB.Preload("OptionGroups.Options").
+		Where("price BETWEEN ? AND ?", minPrice, maxPrice)
+	if value := ctx.Query("category"); value != "" {
+		scope, ok := categoryScope(ctx, value)
+		if !ok {
+			return
+		}
+		ids := make([]uint, 0, len(scope))
+		for id := range scope {
+			ids = append(ids, id)
 		}
+		db = db.Where("category_id IN ?", ids)
 	}
-	// 获取对应的dish
 	var dishes []Dish
-	for _, id := range max_ids {
-		dishes = append(dishes, Dish{ID: id})
+	if err := db.Find(&dishes).Error; err != nil {
+		log.Println()
+		log.Printf("Search dishes error\n")
+		log.Printf("q: %s\n", query)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询菜品失败",
+		})
+		return
 	}
-	if ok := GetManyDatas(ctx, &dishes, "id in ?", max_ids); !ok {
+	dishes, _, ok := presentDishes(ctx, dishes)
+	if !ok {
 		return
 	}
-	// fmt.Println(dishes)
-	ctx.IndentedJSON(http.StatusOK, dishes)
+	if ctx.Query("available") == "true" {
+		orderable := dishes[:0]
+		for _, dish := range dishes {
+			if dish.Available && !dish.SoldOut {
+				orderable = append(orderable, dish)
+			}
+		}
+		dishes = orderable
+	}
+
+	ids := make([]uint, len(dishes))
+	for i := range dishes {
+		ids[i] = dishes[i].ID
+	}
+	sales := map[uint]int{}
+	if len(ids) > 0 {
+		var err error
+		// 热度只影响排序，统计失败时按匹配度排序
+		if sales, err = loadDishSales(ids, searchPopularityDays); err != nil {
+			log.Printf("Load dish sales error: %v\n", err)
+		}
+	}
+	dishes = rankDishes(dishes, query, sales)
+
+	page, size := GetPagination(ctx)
+	total := len(dishes)
+	start := min((page-1)*size, total)
+	end := min(start+size, total)
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"total":  total,
+		"dishes": dishes[start:end],
+	})
 }
 
-// GetTotalPrice 函数计算并返回账单总金额
+// GetTotalPrice 函数计算并返回账单的分项报价：小计、税、服务费、舍入和应付总额
 // 参数:
 //
-//	ctx: gin的上下文对象，用于处理HTTP请求和响应
+//	ctx: gin的上下文对象，用于处理HTTP请求和响应，需携带扫码得到的桌号令牌，查询参数 coupon 为优惠码
 //
 // 返回值:
 //
-//	无返回值，通过gin的上下文对象返回总金额
+//	无返回值，通过gin的上下文对象返回分项报价
 func GetTotalPrice(ctx *gin.Context) {
-	totalPrice := 0
+	var table Table
+	if ok := GetTableFromToken(ctx, &table); !ok {
+		return
+	}
 	var bills []Bill
 	if ok := BindJSON(ctx, &bills); !ok {
 		return
 	}
-	query := map[string]interface{}{"id": 0}
-	for _, bill := range bills {
-		var dish Dish
-		query["id"] = bill.DishID
-		if ok := GetData(ctx, &dish, query); !ok {
-			return
-		}
-		// 防止篡改价格
-		price := dish.Price
-		// 防止篡改数量
-		cnt := bill.Count
-		if cnt <= 0 {
-			log.Printf("Count must be positive, dish_id: %d, count: %d\n", bill.DishID, cnt)
-			ctx.IndentedJSON(http.StatusBadRequest, gin.H{
-				"error": "Count must be positive",
-			})
-			return
+	if err := ResetDailyStock(); err != nil {
+		RespondQuoteError(ctx, err)
+		return
+	}
+	quote, err := QuoteBills(global.DB, bills, ctx.Query("coupon"))
+	if err != nil {
+		RespondQuoteError(ctx, err)
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, quote)
+}
+
+// resetDailyStock 返回菜品前确保售罄状态和剩余份数属于当前营业日，失败只记录日志
+func resetDailyStock() {
+	if err := ResetDailyStock(); err != nil {
+		log.Printf("Reset daily stock error: %v\n", err)
+	}
+}
+
+// markIngredientShortages 把原料不足的菜品标记为售罄，失败只记录日志
+func markIngredientShortages(dishes []Dish) {
+	if err := MarkIngredientShortages(global.DB, dishes); err != nil {
+		log.Printf("Mark ingredient shortages error: %v\n", err)
+	}
+}
+
+// presentDishes 过滤出顾客当前能看到的菜品：分类可见且在供应时段内，并把原料不足的菜品标记为售罄
+// 失败时已写入错误响应
+func presentDishes(ctx *gin.Context, dishes []Dish) ([]Dish, *CategoryTree, bool) {
+	schedule, ok := loadMenuSchedule(ctx)
+	if !ok {
+		return nil, nil, false
+	}
+	categories, err := LoadCategoryTree(global.DB)
+	if err != nil {
+		log.Printf("Load categories error: %v\n", err)
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询分类失败",
+		})
+		return nil, nil, false
+	}
+	now := time.Now()
+	visible := make([]Dish, 0, len(dishes))
+	for i := range dishes {
+		if categories.Visible(dishes[i].CategoryID) && schedule.Available(&dishes[i], now) {
+			visible = append(visible, dishes[i])
 		}
-		totalPrice += price * cnt
 	}
-	ctx.IndentedJSON(http.StatusOK, gin.H{
-		"total_price": totalPrice,
-	})
+	markIngredientShortages(visible)
+	return visible, categories, true
 }
@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// 导出格式
+const (
+	ExportCSV  = "csv"
+	ExportXLSX = "xlsx"
+)
+
+// exportWriter 逐行写出表格，数据不在内存中累积
+type exportWriter interface {
+	WriteRow(values ...interface{}) error
+	Close() error
+}
+
+// newExportWriter 设置下载的响应头并写出表头，name 为不含扩展名的文件名
+func newExportWriter(ctx *gin.Context, format string, name string, sheet string, header []string) (exportWriter, error) {
+	switch format {
+	case ExportCSV:
+		ctx.Header("Content-Type", "text/csv; charset=utf-8")
+		ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, name))
+		ctx.Status(http.StatusOK)
+		// Excel 需要 BOM 才能识别 UTF-8
+		if _, err := ctx.Writer.Write([]byte("\xEF\xBB\xBF")); err != nil {
+			return nil, err
+		}
+		w := &csvExportWriter{writer: csv.NewWriter(ctx.Writer)}
+		return w, w.writer.Write(header)
+	case ExportXLSX:
+		file := excelize.NewFile()
+		if err := file.SetSheetName("Sheet1", sheet); err != nil {
+			return nil, err
+		}
+		// 流式写入，行数多时写到临时文件，不占用内存
+		stream, err := file.NewStreamWriter(sheet)
+		if err != nil {
+			return nil, err
+		}
+		bold, err := file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+		if err != nil {
+			return nil, err
+		}
+		cells := make([]interface{}, len(header))
+		for i, title := range header {
+			cells[i] = excelize.Cell{StyleID: bold, Value: title}
+		}
+		if err := stream.SetRow("A1", cells); err != nil {
+			return nil, err
+		}
+		ctx.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.xlsx"`, name))
+		return &xlsxExportWriter{ctx: ctx, file: file, stream: stream, row: 1}, nil
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+// escapeCell 以 = + - @ 或制表符、回车开头的文本在 Excel 中会被当作公式执行，
+// 菜名、桌号等由用户填写的文本前面加上 ' 按文本显示
+func escapeCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+type csvExportWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvExportWriter) WriteRow(values ...interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case time.Time:
+			record[i] = v.Format("2006-01-02 15:04:05")
+		case string:
+			record[i] = escapeCell(v)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return w.writer.Write(record)
+}
+
+func (w *csvExportWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type xlsxExportWriter struct {
+	ctx    *gin.Context
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	row    int
+}
+
+func (w *xlsxExportWriter) WriteRow(values ...interface{}) error {
+	w.row++
+	cells := make([]interface{}, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case Money:
+			// 金额以元为单位的数字写入，方便在 Excel 中计算
+			cells[i] = float64(v) / 100
+		case time.Time:
+			cells[i] = v.Format("2006-01-02 15:04:05")
+		case string:
+			cells[i] = escapeCell(v)
+		default:
+			cells[i] = v
+		}
+	}
+	cell, err := excelize.CoordinatesToCellName(1, w.row)
+	if err != nil {
+		return err
+	}
+	return w.stream.SetRow(cell, cells)
+}
+
+// Close 结束写入并把文件写到响应中
+func (w *xlsxExportWriter) Close() error {
+	defer w.file.Close()
+	if err := w.stream.Flush(); err != nil {
+		return err
+	}
+	w.ctx.Status(http.StatusOK)
+	_, err := w.file.WriteTo(w.ctx.Writer)
+	return err
+}
+
+// 订单状态的中文名称
+var orderStatusNames = map[string]string{
+	OrderStatusPlaced:    "已下单",
+	OrderStatusAccepted:  "已接单",
+	OrderStatusCooking:   "制作中",
+	OrderStatusServed:    "已上菜",
+	OrderStatusPaid:      "已支付",
+	OrderStatusCancelled: "已取消",
+	OrderStatusVoided:    "已作废",
+	OrderStatusRefunded:  "已退款",
+}
+
+func orderStatusName(status string) string {
+	if name, ok := orderStatusNames[status]; ok {
+		return name
+	}
+	return status
+}
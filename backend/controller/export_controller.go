@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+)
+
+// exportFormat 解析导出格式，默认 csv，失败时已写入错误响应
+func exportFormat(ctx *gin.Context) (string, bool) {
+	format := ctx.DefaultQuery("format", ExportCSV)
+	if format != ExportCSV && format != ExportXLSX {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": "format 只能为 csv 或 xlsx",
+		})
+		return "", false
+	}
+	return format, true
+}
+
+// exportParams 解析导出的格式和营业日范围，失败时已写入错误响应
+func exportParams(ctx *gin.Context) (format string, from string, to string, ok bool) {
+	if format, ok = exportFormat(ctx); !ok {
+		return "", "", "", false
+	}
+	from, to, err := ParseDateRange(ctx.Query("from"), ctx.Query("to"))
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return "", "", "", false
+	}
+	return format, from, to, true
+}
+
+// streamExport 打开查询后写出表头，逐行读取数据库并写出，出错时记录日志
+//
+// 备注：
+//
+//	开始写出后响应头已经发出，只能中断连接；还没有写出任何内容时（如查询失败、xlsx 生成失败）返回 500
+func streamExport(ctx *gin.Context, format string, name string, sheet string, header []string, rows *sql.Rows, err error, writeRow func(w exportWriter, rows *sql.Rows) error) {
+	if err != nil {
+		log.Println()
+		log.Printf("Export %s error\n", name)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "导出失败",
+		})
+		return
+	}
+	defer rows.Close()
+	w, err := newExportWriter(ctx, format, name, sheet, header)
+	for err == nil && rows.Next() {
+		err = writeRow(w, rows)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		log.Println()
+		log.Printf("Export %s error\n", name)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		if ctx.Writer.Written() {
+			ctx.Abort()
+			return
+		}
+		// 去掉下载的响应头，否则错误信息会被当作附件
+		ctx.Writer.Header().Del("Content-Type")
+		ctx.Writer.Header().Del("Content-Disposition")
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "导出失败",
+		})
+	}
+}
+
+// ExportOrders 导出营业日范围内的订单
+//
+// 参数：
+//
+//	ctx *gin.Context: Gin 框架的上下文对象，查询参数 from/to 为营业日范围（含），format 为 csv（默认）或 xlsx，
+//	status 只导出该状态的订单
+//
+// 返回值：
+//
+//	无返回值，以附件形式流式返回表格
+func ExportOrders(ctx *gin.Context) {
+	format, from, to, ok := exportParams(ctx)
+	if !ok {
+		return
+	}
+	start, end := BusinessDayRange(from, to)
+	db := global.DB.Model(&Order{}).Where("created_at >= ? AND created_at < ?", start, end)
+	if status := ctx.Query("status"); status != "" {
+		db = db.Where("status = ?", status)
+	}
+	rows, err := db.Order("id").Rows()
+	header := []string{"订单号", "下单时间", "营业日", "桌号", "状态", "就餐人数", "币种", "小计", "优惠", "税额", "服务费", "舍入", "实收"}
+	streamExport(ctx, format, fmt.Sprintf("orders_%s_%s", from, to), "订单", header, rows, err, func(w exportWriter, rows *sql.Rows) error {
+		var order Order
+		if err := global.DB.ScanRows(rows, &order); err != nil {
+			return err
+		}
+		return w.WriteRow(order.ID, order.CreatedAt.In(global.MENU_CONFIG.Location), BusinessDay(order.CreatedAt),
+			order.TableNo, orderStatusName(order.Status), order.Guests, order.Currency,
+			order.Subtotal, order.Discount, order.Tax, order.ServiceCharge, order.Rounding, order.Total)
+	})
+}
+
+// recordExportRow 导出的订单明细，菜品名和分类取菜品当前的信息
+type recordExportRow struct {
+	ID          uint
+	OrderID     uint
+	CreatedAt   time.Time
+	TableNo     string
+	OrderStatus string
+	DishID      uint
+	DishName    string
+	CategoryID  uint
+	Options     string
+	Price       Money
+	Count       int
+	Discount    Money
+}
+
+// ExportRecords 导出营业日范围内订单的明细，每道菜一行，金额取下单时的价格快照
+//
+// 参数：
+//
+//	ctx *gin.Context: Gin 框架的上下文对象，查询参数 from/to 为营业日范围（含），format 为 csv（默认）或 xlsx
+//
+// 返回值：
+//
+//	无返回值，以附件形式流式返回表格
+func ExportRecords(ctx *gin.Context) {
+	format, from, to, ok := exportParams(ctx)
+	if !ok {
+		return
+	}
+	categories, err := LoadCategoryTree(global.DB)
+	if err != nil {
+		log.Printf("Load categories error: %v\n", err)
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询分类失败",
+		})
+		return
+	}
+	start, end := BusinessDayRange(from, to)
+	rows, err := global.DB.Table("records").
+		Select("records.id, records.order_id, orders.created_at, orders.table_no, orders.status AS order_status, "+
+			"records.dish_id, COALESCE(dishes.name, '') AS dish_name, COALESCE(dishes.category_id, 0) AS category_id, "+
+			"COALESCE((SELECT GROUP_CONCAT(record_options.name SEPARATOR '、') FROM record_options WHERE record_options.record_id = records.id), '') AS options, "+
+			"records.price, records.count, records.discount").
+		Joins("JOIN orders ON orders.id = records.order_id").
+		Joins("LEFT JOIN dishes ON dishes.id = records.dish_id").
+		Where("orders.created_at >= ? AND orders.created_at < ?", start, end).
+		Order("records.id").
+		Rows()
+	header := []string{"明细号", "订单号", "下单时间", "桌号", "订单状态", "菜品", "分类", "规格", "单价", "数量", "优惠", "金额"}
+	streamExport(ctx, format, fmt.Sprintf("records_%s_%s", from, to), "订单明细", header, rows, err, func(w exportWriter, rows *sql.Rows) error {
+		var record recordExportRow
+		if err := global.DB.ScanRows(rows, &record); err != nil {
+			return err
+		}
+		if record.DishName == "" {
+			record.DishName = fmt.Sprintf("已删除菜品 #%d", record.DishID)
+		}
+		return w.WriteRow(record.ID, record.OrderID, record.CreatedAt.In(global.MENU_CONFIG.Location), record.TableNo,
+			orderStatusName(record.OrderStatus), record.DishName, categories.Name(record.CategoryID), record.Options,
+			record.Price, record.Count, record.Discount, record.Price*Money(record.Count)-record.Discount)
+	})
+}
+
+// ExportReport 导出报表，name 为 sales（销售报表，参数同 GET /admin/reports/sales）或 low_stock（低库存报表）
+//
+// 参数：
+//
+//	ctx *gin.Context: Gin 框架的上下文对象，查询参数 format 为 csv（默认）或 xlsx
+//
+// 返回值：
+//
+//	无返回值，以附件形式返回表格
+func ExportReport(ctx *gin.Context) {
+	format, ok := exportFormat(ctx)
+	if !ok {
+		return
+	}
+	var name, sheet string
+	var header []string
+	var write func(w exportWriter) error
+	switch ctx.Param("name") {
+	case "sales":
+		report, ok := buildSalesReport(ctx)
+		if !ok {
+			return
+		}
+		name, sheet = fmt.Sprintf("sales_%s_%s_%s", report.GroupBy, report.From, report.To), "销售报表"
+		header = []string{"分组", "实收", "折后销售额", "订单数", "就餐人数", "单均", "菜品份数"}
+		write = func(w exportWriter) error {
+			for _, row := range append(report.Rows, report.Summary) {
+				err := w.WriteRow(row.Label, row.Revenue, row.NetSales, row.Orders, row.Covers, row.AverageTicket, row.Items)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case "low_stock":
+		report, err := LowStockReport(global.DB)
+		if err != nil {
+			log.Println()
+			log.Printf("Query low stock error\n")
+			log.Printf("%v\n", err.Error())
+			log.Println()
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+				"error": "查询失败",
+			})
+			return
+		}
+		name, sheet = "low_stock_"+BusinessDay(time.Now()), "低库存"
+		header = []string{"原料", "单位", "现有库存", "补货线", "无法售卖的菜品"}
+		write = func(w exportWriter) error {
+			for _, item := range report {
+				err := w.WriteRow(item.Name, item.Unit, item.OnHand, item.ReorderLevel, strings.Join(item.Dishes, "、"))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	default:
+		ctx.IndentedJSON(http.StatusNotFound, gin.H{
+			"error": "报表不存在",
+		})
+		return
+	}
+
+	w, err := newExportWriter(ctx, format, name, sheet, header)
+	if err == nil {
+		err = write(w)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		log.Println()
+		log.Printf("Export %s error\n", name)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.Abort()
+	}
+}
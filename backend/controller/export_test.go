@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+)
+
+func TestEscapeCell(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"回锅肉", "回锅肉"},
+		{"A12", "A12"},
+		{"", ""},
+		{"=HYPERLINK(\"http://x\")", "'=HYPERLINK(\"http://x\")"},
+		{"+1", "'+1"},
+		{"-1+1", "'-1+1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"少辣=微辣", "少辣=微辣"},
+	}
+	for _, tt := range tests {
+		if got := escapeCell(tt.value); got != tt.want {
+			t.Errorf("escapeCell(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+// exportRows 从 fakeDB 取得 n 行的查询结果
+func exportRows(t *testing.T, n int) *sql.Rows {
+	t.Helper()
+	rows := make([][]driver.Value, n)
+	for i := range rows {
+		rows[i] = []driver.Value{int64(i + 1)}
+	}
+	useFakeDB(t, fakeResult{match: "FROM `orders`", columns: []string{"id"}, rows: rows})
+	result, err := global.DB.Table("orders").Select("id").Rows()
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	return result
+}
+
+func TestStreamExport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	export := func(format string, sheet string, rows *sql.Rows, writeRow func(w exportWriter, rows *sql.Rows) error) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/admin/exports/orders", nil)
+		streamExport(ctx, format, "orders", sheet, []string{"订单号", "桌号"}, rows, nil, writeRow)
+		return w
+	}
+	userText := func(w exportWriter, rows *sql.Rows) error {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		return w.WriteRow(id, "=1+1", Money(-150))
+	}
+
+	t.Run("csv 转义公式", func(t *testing.T) {
+		w := export(ExportCSV, "订单", exportRows(t, 1), userText)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", w.Code)
+		}
+		want := "\xEF\xBB\xBF订单号,桌号\n1,'=1+1,-1.50\n"
+		if got := w.Body.String(); got != want {
+			t.Errorf("body = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("xlsx", func(t *testing.T) {
+		w := export(ExportXLSX, "订单", exportRows(t, 2), userText)
+		if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "PK") {
+			t.Errorf("status = %d, body starts with %q; want a zip file", w.Code, w.Body.String()[:min(4, w.Body.Len())])
+		}
+	})
+
+	t.Run("xlsx 生成失败", func(t *testing.T) {
+		// 工作表名称不能包含冒号
+		w := export(ExportXLSX, "订单:明细", exportRows(t, 1), userText)
+		if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "导出失败") {
+			t.Errorf("status = %d, body %s; want 500 导出失败", w.Code, w.Body.String())
+		}
+		if disposition := w.Header().Get("Content-Disposition"); disposition != "" {
+			t.Errorf("Content-Disposition = %q, want none", disposition)
+		}
+	})
+
+	t.Run("xlsx 写出前出错", func(t *testing.T) {
+		w := export(ExportXLSX, "订单", exportRows(t, 1), func(exportWriter, *sql.Rows) error {
+			return errors.New("scan failed")
+		})
+		if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "导出失败") {
+			t.Errorf("status = %d, body %s; want 500 导出失败", w.Code, w.Body.String())
+		}
+		if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+			t.Errorf("Content-Type = %q, want json", contentType)
+		}
+	})
+
+	t.Run("csv 已开始写出", func(t *testing.T) {
+		// 表头已经发出，只能中断
+		w := export(ExportCSV, "订单", exportRows(t, 1), func(exportWriter, *sql.Rows) error {
+			return errors.New("scan failed")
+		})
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "导出失败") {
+			t.Errorf("status = %d, body %s; want the partial csv", w.Code, w.Body.String())
+		}
+	})
+}
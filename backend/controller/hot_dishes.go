@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/m/v2/global"
+)
+
+// 超过这么久没人查询的统计窗口不再刷新
+const hotRankingIdle = time.Hour
+
+// ParseWindow 解析统计窗口，支持按天（7d）和 Go 的时长格式（24h、90m）
+func ParseWindow(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid window %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %q", value)
+	}
+	return d, nil
+}
+
+type hotRanking struct {
+	dishIDs    []uint // 按热度从高到低，包括暂时售罄或隐藏的菜品
+	computedAt time.Time
+	lastUsed   time.Time
+}
+
+// 各统计窗口的热销排行，后台定时刷新，请求时只读缓存
+var hotRankings = struct {
+	sync.Mutex
+	entries map[time.Duration]*hotRanking
+}{entries: map[time.Duration]*hotRanking{}}
+
+// HotDishRanking 返回统计窗口内按热度排序的菜品 ID，缓存过期时才重新统计
+func HotDishRanking(window time.Duration) ([]uint, error) {
+	now := time.Now()
+	hotRankings.Lock()
+	entry, ok := hotRankings.entries[window]
+	if ok {
+		entry.lastUsed = now
+	}
+	hotRankings.Unlock()
+	// 后台刷新停止或落后太多时才在请求中统计
+	if ok && now.Sub(entry.computedAt) < 2*global.MENU_CONFIG.HotDishes.RefreshInterval {
+		return entry.dishIDs, nil
+	}
+	dishIDs, err := computeHotRanking(window, now)
+	if err != nil {
+		return nil, err
+	}
+	hotRankings.Lock()
+	hotRankings.entries[window] = &hotRanking{dishIDs: dishIDs, computedAt: now, lastUsed: now}
+	hotRankings.Unlock()
+	return dishIDs, nil
+}
+
+// computeHotRanking 汇总窗口内各菜品的销量，不含取消、作废和退款的订单
+//
+// 备注：
+//
+//	已计入汇总表的订单从小时汇总表读取，还没结账或还没计入的订单从原始明细统计；
+//	配置了半衰期时每份按 0.5^(距今时长/半衰期) 加权，上周的销量比上个月的更重要
+func computeHotRanking(window time.Duration, now time.Time) ([]uint, error) {
+	halfLife := global.MENU_CONFIG.HotDishes.HalfLife
+	weighted := func(count string, at string) (string, []interface{}) {
+		if halfLife <= 0 {
+			return "SUM(" + count + ")", nil
+		}
+		return "SUM(" + count + " * POW(0.5, TIMESTAMPDIFF(SECOND, " + at + ", ?) / ?))",
+			[]interface{}{now, halfLife.Seconds()}
+	}
+
+	var rolledUp []struct {
+		DimensionKey string
+		Score        float64
+	}
+	score, args := weighted("items", "start")
+	err := global.DB.Model(&HourlySalesRollup{}).
+		Select("dimension_key, "+score+" AS score", args...).
+		Where("dimension = ? AND start >= ?", RollupDish, now.Add(-window)).
+		Group("dimension_key").
+		Scan(&rolledUp).Error
+	if err != nil {
+		return nil, err
+	}
+	var pending []struct {
+		DishID uint
+		Score  float64
+	}
+	score, args = weighted("records.count", "orders.created_at")
+	err = global.DB.Table("records").
+		Select("records.dish_id, "+score+" AS score", args...).
+		Joins("JOIN orders ON orders.id = records.order_id").
+		Where("orders.status NOT IN ?", []string{OrderStatusCancelled, OrderStatusVoided, OrderStatusRefunded}).
+		Where("orders.rolled_up = ?", "").
+		Where("orders.created_at >= ?", now.Add(-window)).
+		Group("records.dish_id").
+		Scan(&pending).Error
+	if err != nil {
+		return nil, err
+	}
+
+	scores := map[uint]float64{}
+	for _, row := range rolledUp {
+		if id, err := strconv.ParseUint(row.DimensionKey, 10, 64); err == nil {
+			scores[uint(id)] += row.Score
+		}
+	}
+	for _, row := range pending {
+		scores[row.DishID] += row.Score
+	}
+	dishIDs := make([]uint, 0, len(scores))
+	for id, score := range scores {
+		// 全部退款冲销后销量为 0
+		if score > 0 {
+			dishIDs = append(dishIDs, id)
+		}
+	}
+	sort.Slice(dishIDs, func(i, j int) bool {
+		if scores[dishIDs[i]] != scores[dishIDs[j]] {
+			return scores[dishIDs[i]] > scores[dishIDs[j]]
+		}
+		return dishIDs[i] < dishIDs[j]
+	})
+	return dishIDs, nil
+}
+
+// StartHotDishesRefresh 定时刷新最近被查询过的统计窗口，长时间没人查询的窗口从缓存中移除
+func StartHotDishesRefresh() {
+	go func() {
+		ticker := time.NewTicker(global.MENU_CONFIG.HotDishes.RefreshInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			hotRankings.Lock()
+			var windows []time.Duration
+			for window, entry := range hotRankings.entries {
+				if now.Sub(entry.lastUsed) > hotRankingIdle {
+					delete(hotRankings.entries, window)
+				} else {
+					windows = append(windows, window)
+				}
+			}
+			hotRankings.Unlock()
+
+			for _, window := range windows {
+				dishIDs, err := computeHotRanking(window, now)
+				if err != nil {
+					log.Printf("Refresh hot dishes error, window: %v, error: %v\n", window, err)
+					continue
+				}
+				hotRankings.Lock()
+				if entry, ok := hotRankings.entries[window]; ok {
+					entry.dishIDs, entry.computedAt = dishIDs, now
+				}
+				hotRankings.Unlock()
+			}
+		}
+	}()
+}
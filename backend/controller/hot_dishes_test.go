@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"7d", 7 * 24 * time.Hour, false},
+		{"1d", 24 * time.Hour, false},
+		{"90d", 90 * 24 * time.Hour, false},
+		{"24h", 24 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"0d", 0, true},
+		{"-1d", 0, true},
+		{"0s", 0, true},
+		{"-1h", 0, true},
+		{"d", 0, true},
+		{"1.5d", 0, true},
+		{"7", 0, true},
+		{"", 0, true},
+		{"week", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseWindow(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseWindow(%q) = %v, %v; want %v, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// useHotRanking 在测试期间缓存统计窗口的排行，不需要统计
+func useHotRanking(t *testing.T, window time.Duration, dishIDs ...uint) {
+	t.Helper()
+	now := time.Now()
+	hotRankings.Lock()
+	hotRankings.entries[window] = &hotRanking{dishIDs: dishIDs, computedAt: now, lastUsed: now}
+	hotRankings.Unlock()
+	t.Cleanup(func() {
+		hotRankings.Lock()
+		delete(hotRankings.entries, window)
+		hotRankings.Unlock()
+	})
+}
+
+func TestGetHotDishes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setMenuConfig(t, "Asia/Shanghai", "04:00")
+	global.MENU_CONFIG.HotDishes = global.HotDishesConfig{
+		Window:          "7d",
+		Windows:         []string{"24h", "7d"},
+		Limit:           3,
+		MaxLimit:        50,
+		RefreshInterval: time.Minute,
+	}
+	useHotRanking(t, 7*24*time.Hour, 2, 3, 4, 6, 5, 1, 7)
+	useHotRanking(t, 24*time.Hour, 1, 2)
+	dish := func(id uint, categoryID uint, available bool, soldOut bool) []driver.Value {
+		return []driver.Value{int64(id), fmt.Sprintf("菜%d", id), int64(categoryID), available, soldOut}
+	}
+	useFakeDB(t, fakeResult{
+		match:   "FROM `dishes`",
+		columns: []string{"id", "name", "category_id", "available", "sold_out"},
+		rows: [][]driver.Value{
+			dish(1, 10, true, false),
+			dish(2, 10, true, true),   // 售罄
+			dish(3, 10, false, false), // 下架
+			dish(4, 20, true, false),  // 分类隐藏
+			dish(5, 11, true, false),  // 子分类
+			dish(6, 30, true, false),
+			dish(7, 30, true, false),
+		},
+	}, fakeResult{
+		match:   "FROM `categories`",
+		columns: []string{"id", "name", "visible", "parent_id"},
+		rows: [][]driver.Value{
+			{int64(10), "热菜", true, nil},
+			{int64(11), "小炒", true, int64(10)},
+			{int64(20), "隐藏", false, nil},
+			{int64(30), "凉菜", true, nil},
+		},
+	})
+
+	tests := []struct {
+		query string
+		code  int
+		want  []uint
+	}{
+		{"", http.StatusOK, []uint{6, 5, 1}}, // 默认 7d、limit 3
+		{"?limit=10", http.StatusOK, []uint{6, 5, 1, 7}},
+		{"?limit=1", http.StatusOK, []uint{6}},
+		{"?window=24h", http.StatusOK, []uint{1}},
+		{"?category=10&limit=10", http.StatusOK, []uint{5, 1}}, // 含子分类
+		{"?category=30&limit=10", http.StatusOK, []uint{6, 7}},
+		{"?window=30d", http.StatusBadRequest, nil},  // 不在 windows 中
+		{"?window=168h", http.StatusBadRequest, nil}, // 与 7d 等长也不接受
+		{"?window=1s", http.StatusBadRequest, nil},
+		{"?limit=0", http.StatusBadRequest, nil},
+		{"?limit=51", http.StatusBadRequest, nil},
+		{"?limit=abc", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		r := gin.New()
+		r.GET("/api/hot_dishes", GetHotDishes)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/hot_dishes"+tt.query, nil))
+		if w.Code != tt.code {
+			t.Errorf("GET %s status = %d, want %d, body %s", tt.query, w.Code, tt.code, w.Body.String())
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var dishes []Dish
+		if err := json.Unmarshal(w.Body.Bytes(), &dishes); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		got := make([]uint, 0, len(dishes))
+		for _, dish := range dishes {
+			got = append(got, dish.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("GET %s = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// 不接受的窗口不会新增缓存
+	hotRankings.Lock()
+	defer hotRankings.Unlock()
+	for window := range hotRankings.entries {
+		if window != 7*24*time.Hour && window != 24*time.Hour {
+			t.Errorf("unexpected cached window %v", window)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// IdempotencyKeyHeader 下单请求携带幂等键的请求头
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// errIdempotencyLeaseLost 处理太久，幂等键的占用已过期并可能被重复请求重新占用，订单需要回滚
+var errIdempotencyLeaseLost = errors.New("idempotency key lease expired")
+
+// HashSubmitRequest 计算下单请求的摘要，同一个幂等键只能用于内容相同的请求，
+// 桌子、优惠码、就餐人数和点菜明细任一不同都视为不同的请求
+func HashSubmitRequest(tableID uint, bills []Bill, coupon string, guests int) string {
+	body, _ := json.Marshal(bills)
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%s|%d|%s", tableID, coupon, guests, body)))
+	return hex.EncodeToString(sum[:])
+}
+
+// ClaimIdempotencyKey 读取请求头中的幂等键并占用它
+//
+// 参数：
+//
+//	ctx *gin.Context: Gin 框架的上下文对象
+//	tableID uint: 下单的桌子，幂等键只在同一张桌子内有效
+//	requestHash string: 请求摘要，见 HashSubmitRequest
+//
+// 返回值：
+//
+//	*IdempotencyKey: 占用成功的幂等键，请求未携带幂等键时为 nil
+//	bool: 需要继续处理请求时返回 true；重复请求已重放第一次的响应、或请求被拒绝时返回 false
+//
+// 备注：
+//
+//	第一次的请求仍在处理中返回 409，同一个键用于不同的请求返回 422；
+//	处理中的键只占用 idempotency_lease，进程崩溃没有完成或释放时，过期后可以重新占用
+func ClaimIdempotencyKey(ctx *gin.Context, tableID uint, requestHash string) (*IdempotencyKey, bool) {
+	value := ctx.GetHeader(IdempotencyKeyHeader)
+	if value == "" {
+		return nil, true
+	}
+	if len(value) > 128 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": "Idempotency-Key 过长",
+		})
+		return nil, false
+	}
+
+	now := time.Now()
+	key := &IdempotencyKey{
+		Key:         value,
+		TableID:     tableID,
+		RequestHash: requestHash,
+		ExpiresAt:   now.Add(global.ORDER_CONFIG.IdempotencyLease),
+	}
+	// 过期的键可以重新使用，包括占用过期的处理中的键
+	global.DB.Where("idempotency_key = ? AND expires_at < ?", value, now).Delete(&IdempotencyKey{})
+	// 唯一索引保证并发的重复请求只有一个能占用成功
+	if err := global.DB.Create(key).Error; err == nil {
+		return key, true
+	}
+
+	var existing IdempotencyKey
+	if err := global.DB.Where("idempotency_key = ?", value).First(&existing).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println()
+			log.Printf("Query idempotency key error\n")
+			log.Printf("key: %s\n", value)
+			log.Printf("error: %s\n", err.Error())
+			log.Println()
+		}
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "提交失败，请重试",
+		})
+		return nil, false
+	}
+	if existing.TableID != tableID || existing.RequestHash != requestHash {
+		ctx.IndentedJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Idempotency-Key 已用于其他请求",
+		})
+		return nil, false
+	}
+	if existing.StatusCode == 0 {
+		ctx.IndentedJSON(http.StatusConflict, gin.H{
+			"error": "订单正在提交，请稍候",
+		})
+		return nil, false
+	}
+	log.Printf("Replay idempotent response, key: %s, order: %d\n", value, existing.OrderID)
+	ctx.Header("Idempotent-Replayed", "true")
+	ctx.Data(existing.StatusCode, "application/json; charset=utf-8", []byte(existing.Response))
+	return nil, false
+}
+
+// CompleteIdempotencyKey 在创建订单的事务中保存响应并延长到 idempotency_window，之后的重复请求直接重放
+// 占用已过期被清理时返回错误，避免和重新占用的请求重复下单
+func CompleteIdempotencyKey(tx *gorm.DB, key *IdempotencyKey, orderID uint, statusCode int, response interface{}) error {
+	body, err := json.MarshalIndent(response, "", "    ")
+	if err != nil {
+		return err
+	}
+	key.OrderID = orderID
+	key.StatusCode = statusCode
+	key.Response = string(body)
+	key.ExpiresAt = time.Now().Add(global.ORDER_CONFIG.IdempotencyWindow)
+	result := tx.Model(key).Where("status_code = ?", 0).
+		Select("order_id", "status_code", "response", "expires_at").Updates(key)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errIdempotencyLeaseLost
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey 请求失败时释放幂等键，客户端修改后可以用同一个键重新提交
+func ReleaseIdempotencyKey(key *IdempotencyKey) {
+	if err := global.DB.Delete(key).Error; err != nil {
+		log.Printf("Release idempotency key %s error: %v\n", key.Key, err)
+	}
+}
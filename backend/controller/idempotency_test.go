@@ -0,0 +1,25 @@
+package controller
+
+import "testing"
+
+func TestHashSubmitRequest(t *testing.T) {
+	bills := []Bill{{DishID: 1, Count: 2}}
+	base := HashSubmitRequest(1, bills, "SAVE10", 4)
+	if again := HashSubmitRequest(1, []Bill{{DishID: 1, Count: 2}}, "SAVE10", 4); again != base {
+		t.Errorf("same request hashed to %s and %s", base, again)
+	}
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"桌子不同", HashSubmitRequest(2, bills, "SAVE10", 4)},
+		{"明细不同", HashSubmitRequest(1, []Bill{{DishID: 1, Count: 3}}, "SAVE10", 4)},
+		{"优惠码不同", HashSubmitRequest(1, bills, "", 4)},
+		{"就餐人数不同", HashSubmitRequest(1, bills, "SAVE10", 5)},
+	}
+	for _, tt := range tests {
+		if tt.hash == base {
+			t.Errorf("%s: HashSubmitRequest() = %s, want a different hash", tt.name, tt.hash)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png" // 注册 PNG 解码
+	"net/http"
+
+	"example.com/m/v2/global"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // 注册 WebP 解码
+)
+
+var (
+	errUnsupportedImage = errors.New("unsupported image type")
+	errImageTooLarge    = errors.New("image too large")
+)
+
+// imageExts 允许上传的图片类型及保存原图时使用的扩展名，按文件内容判断，不信任文件名和请求头
+var imageExts = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/webp": "webp",
+}
+
+// ImageVariant 一种尺寸的图片
+type ImageVariant struct {
+	Name        string // original / medium / thumb
+	Ext         string
+	ContentType string
+	Data        []byte
+}
+
+// ProcessImage 校验上传的图片，并生成中图和缩略图
+//
+// 参数：
+//
+//	data []byte: 上传的文件内容
+//
+// 返回值：
+//
+//	[]ImageVariant: 原图、中图、缩略图，后两者统一转为 JPEG
+//	error: 不支持的类型返回 errUnsupportedImage，尺寸过大返回 errImageTooLarge
+func ProcessImage(data []byte) ([]ImageVariant, error) {
+	contentType := http.DetectContentType(data)
+	ext, ok := imageExts[contentType]
+	if !ok {
+		return nil, errUnsupportedImage
+	}
+	// 先只读取宽高，避免解码超大图片耗尽内存
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errUnsupportedImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > global.UPLOAD_CONFIG.MaxPixels {
+		return nil, errImageTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errUnsupportedImage
+	}
+
+	variants := []ImageVariant{{Name: "original", Ext: ext, ContentType: contentType, Data: data}}
+	for _, size := range []struct {
+		name string
+		max  int
+	}{
+		{"medium", global.UPLOAD_CONFIG.MediumSize},
+		{"thumb", global.UPLOAD_CONFIG.ThumbSize},
+	} {
+		resized, err := resizeJPEG(src, size.max)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, ImageVariant{Name: size.name, Ext: "jpg", ContentType: "image/jpeg", Data: resized})
+	}
+	return variants, nil
+}
+
+// resizeJPEG 把图片等比缩小到最长边不超过 limit（不放大），透明部分填充白色，编码为 JPEG
+func resizeJPEG(src image.Image, limit int) ([]byte, error) {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if longest := max(width, height); longest > limit {
+		width, height = max(width*limit/longest, 1), max(height*limit/longest, 1)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+)
+
+// UploadDishImage 上传菜品图片，multipart 字段名为 image，支持 JPEG、PNG、WebP
+//
+// 备注：
+//
+//	保存原图并生成中图和缩略图，菜品的 Img 设为中图、ImgThumb 为缩略图、ImgOriginal 为原图；
+//	每次上传的文件名都不同，可以长期缓存，旧图片在更新成功后删除
+func UploadDishImage(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var dish Dish
+	if ok := GetData(ctx, &dish, map[string]interface{}{"id": id}); !ok {
+		return
+	}
+	maxSize := global.UPLOAD_CONFIG.MaxSize
+	// 额外留出 multipart 边界等开销
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxSize+1<<20)
+	file, header, err := ctx.Request.FormFile("image")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondImageTooLarge(ctx)
+		} else {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+				"error": "请上传图片，字段名为 image",
+			})
+		}
+		return
+	}
+	defer file.Close()
+	if header.Size > maxSize {
+		respondImageTooLarge(ctx)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil || int64(len(data)) > maxSize {
+		respondImageTooLarge(ctx)
+		return
+	}
+
+	variants, err := ProcessImage(data)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedImage):
+			ctx.IndentedJSON(http.StatusUnsupportedMediaType, gin.H{
+				"error": "只支持 JPEG、PNG、WebP 格式的图片",
+			})
+		case errors.Is(err, errImageTooLarge):
+			respondImageTooLarge(ctx)
+		default:
+			log.Printf("Process image error, dish: %d, error: %v\n", dish.ID, err)
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+				"error": "图片处理失败",
+			})
+		}
+		return
+	}
+
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		log.Printf("Generate image name error: %v\n", err)
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "图片保存失败",
+		})
+		return
+	}
+	urls := map[string]string{}
+	saved := make([]string, 0, len(variants))
+	for _, variant := range variants {
+		key := fmt.Sprintf("dishes/%d/%s-%s.%s", dish.ID, hex.EncodeToString(token), variant.Name, variant.Ext)
+		url, err := global.STORAGE.Save(ctx.Request.Context(), key, variant.ContentType, variant.Data)
+		if err != nil {
+			log.Println()
+			log.Printf("Save image error\n")
+			log.Printf("dish: %d, key: %s\n", dish.ID, key)
+			log.Printf("%v\n", err.Error())
+			log.Println()
+			deleteImages(ctx, saved)
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+				"error": "图片保存失败",
+			})
+			return
+		}
+		saved = append(saved, key)
+		urls[variant.Name] = url
+	}
+
+	oldURLs := []string{dish.Img, dish.ImgThumb, dish.ImgOriginal}
+	dish.Img, dish.ImgThumb, dish.ImgOriginal = urls["medium"], urls["thumb"], urls["original"]
+	if err := global.DB.Select("img", "img_thumb", "img_original").Updates(&dish).Error; err != nil {
+		log.Println()
+		log.Printf("Update dish image error\n")
+		log.Printf("dish: %d\n", dish.ID)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		deleteImages(ctx, saved)
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "更新失败",
+		})
+		return
+	}
+	oldKeys := make([]string, 0, len(oldURLs))
+	for _, url := range oldURLs {
+		if key, ok := global.STORAGE.KeyOf(url); ok {
+			oldKeys = append(oldKeys, key)
+		}
+	}
+	deleteImages(ctx, oldKeys)
+	ctx.IndentedJSON(http.StatusOK, dish)
+}
+
+// deleteImages 删除图片，失败只留下无用文件，记录日志后继续
+// 客户端断开导致保存失败时请求的 context 已取消，删除不随请求取消
+func deleteImages(ctx *gin.Context, keys []string) {
+	c := context.WithoutCancel(ctx.Request.Context())
+	for _, key := range keys {
+		if err := global.STORAGE.Delete(c, key); err != nil {
+			log.Printf("Delete image error, key: %s, error: %v\n", key, err)
+		}
+	}
+}
+
+func respondImageTooLarge(ctx *gin.Context) {
+	ctx.IndentedJSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error": fmt.Sprintf("图片不能超过 %d MB，像素不能超过 %d 万", global.UPLOAD_CONFIG.MaxSize>>20, global.UPLOAD_CONFIG.MaxPixels/10000),
+	})
+}
@@ -0,0 +1,199 @@
+package controller
+
+import (
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 出入库类型
+const (
+	MovementDelivery = "delivery" // 到货入库
+	MovementWaste    = "waste"    // 报损
+	MovementCount    = "count"    // 盘点，按实际数量修正
+	MovementOrder    = "order"    // 下单扣减
+	MovementReturn   = "return"   // 订单取消退回
+)
+
+// IsManualMovement 判断是否为可以手动录入的出入库类型
+func IsManualMovement(movementType string) bool {
+	return movementType == MovementDelivery || movementType == MovementWaste || movementType == MovementCount
+}
+
+// shortDishIDs 返回 dishIDs 中因任一原料不足一份而无法制作的菜品
+func shortDishIDs(db *gorm.DB, dishIDs []uint) (map[uint]bool, error) {
+	short := map[uint]bool{}
+	if len(dishIDs) == 0 {
+		return short, nil
+	}
+	var ids []uint
+	err := db.Model(&RecipeItem{}).
+		Distinct("recipe_items.dish_id").
+		Joins("JOIN ingredients ON ingredients.id = recipe_items.ingredient_id").
+		Where("recipe_items.dish_id IN ?", dishIDs).
+		Where("ingredients.on_hand < recipe_items.quantity").
+		Pluck("recipe_items.dish_id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		short[id] = true
+	}
+	return short, nil
+}
+
+// MarkIngredientShortages 把原料不足的菜品标记为售罄，只影响返回的数据，不写入数据库
+func MarkIngredientShortages(db *gorm.DB, dishes []Dish) error {
+	ids := make([]uint, 0, len(dishes))
+	for _, dish := range dishes {
+		ids = append(ids, dish.ID)
+	}
+	short, err := shortDishIDs(db, ids)
+	if err != nil {
+		return err
+	}
+	for i := range dishes {
+		if short[dishes[i].ID] {
+			dishes[i].SoldOut = true
+		}
+	}
+	return nil
+}
+
+// consumeIngredients 在下单事务中按配方扣减原料并写入流水，需在订单创建之后调用
+//
+// 备注：
+//
+//	扣减是条件更新，库存不足时返回 *BillError，整个订单回滚；按原料 ID 顺序加锁，避免并发下单死锁
+func consumeIngredients(tx *gorm.DB, order *Order, quote *Quote) error {
+	dishIDs := make([]uint, 0, len(quote.records))
+	for _, record := range quote.records {
+		dishIDs = append(dishIDs, record.DishID)
+	}
+	var recipe []RecipeItem
+	if err := tx.Where("dish_id IN ?", dishIDs).Find(&recipe).Error; err != nil {
+		return err
+	}
+	if len(recipe) == 0 {
+		return nil
+	}
+	perDish := map[uint][]RecipeItem{}
+	for _, item := range recipe {
+		perDish[item.DishID] = append(perDish[item.DishID], item)
+	}
+
+	need := map[uint]int64{}
+	firstLine := map[uint]int{}
+	for line, record := range quote.records {
+		for _, item := range perDish[record.DishID] {
+			if _, ok := need[item.IngredientID]; !ok {
+				firstLine[item.IngredientID] = line
+			}
+			need[item.IngredientID] += item.Quantity * int64(record.Count)
+		}
+	}
+	ingredientIDs := make([]uint, 0, len(need))
+	for id := range need {
+		ingredientIDs = append(ingredientIDs, id)
+	}
+	sort.Slice(ingredientIDs, func(i, j int) bool { return ingredientIDs[i] < ingredientIDs[j] })
+
+	for _, id := range ingredientIDs {
+		result := tx.Model(&Ingredient{}).
+			Where("id = ? AND on_hand >= ?", id, need[id]).
+			Update("on_hand", gorm.Expr("on_hand - ?", need[id]))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			line := firstLine[id]
+			dish := quote.dishes[line]
+			return &BillError{Line: line, DishID: dish.ID, Msg: dish.Name + "原料不足，暂不可点"}
+		}
+		if err := addMovement(tx, id, &StockMovement{
+			Type:     MovementOrder,
+			Quantity: -need[id],
+			OrderID:  order.ID,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returnIngredients 订单取消或作废时退回下单扣减的原料
+func returnIngredients(tx *gorm.DB, orderID uint, userID uint) error {
+	var movements []StockMovement
+	if err := tx.Where("order_id = ? AND type = ?", orderID, MovementOrder).
+		Order("ingredient_id").Find(&movements).Error; err != nil {
+		return err
+	}
+	for _, movement := range movements {
+		if err := tx.Model(&Ingredient{}).Where("id = ?", movement.IngredientID).
+			Update("on_hand", gorm.Expr("on_hand + ?", -movement.Quantity)).Error; err != nil {
+			return err
+		}
+		if err := addMovement(tx, movement.IngredientID, &StockMovement{
+			Type:     MovementReturn,
+			Quantity: -movement.Quantity,
+			OrderID:  orderID,
+			UserID:   userID,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addMovement 读取更新后的库存作为流水的结余并写入流水，需在同一事务中先更新库存
+func addMovement(tx *gorm.DB, ingredientID uint, movement *StockMovement) error {
+	var ingredient Ingredient
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "on_hand").First(&ingredient, ingredientID).Error; err != nil {
+		return err
+	}
+	movement.IngredientID = ingredientID
+	movement.Balance = ingredient.OnHand
+	return tx.Create(movement).Error
+}
+
+// LowStockReport 库存不高于补货线的原料，以及因原料不足无法售卖的菜品
+func LowStockReport(db *gorm.DB) ([]LowStockItem, error) {
+	var ingredients []Ingredient
+	if err := db.Where("on_hand <= reorder_level").Order("name").Find(&ingredients).Error; err != nil {
+		return nil, err
+	}
+	var shortages []struct {
+		IngredientID uint
+		Name         string
+	}
+	if len(ingredients) > 0 {
+		ids := make([]uint, 0, len(ingredients))
+		for _, ingredient := range ingredients {
+			ids = append(ids, ingredient.ID)
+		}
+		err := db.Model(&RecipeItem{}).
+			Select("recipe_items.ingredient_id, dishes.name").
+			Joins("JOIN ingredients ON ingredients.id = recipe_items.ingredient_id").
+			Joins("JOIN dishes ON dishes.id = recipe_items.dish_id").
+			Where("recipe_items.ingredient_id IN ?", ids).
+			Where("ingredients.on_hand < recipe_items.quantity").
+			Scan(&shortages).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	dishes := map[uint][]string{}
+	for _, shortage := range shortages {
+		dishes[shortage.IngredientID] = append(dishes[shortage.IngredientID], shortage.Name)
+	}
+	report := make([]LowStockItem, 0, len(ingredients))
+	for _, ingredient := range ingredients {
+		report = append(report, LowStockItem{
+			Ingredient: ingredient,
+			Dishes:     append([]string{}, dishes[ingredient.ID]...),
+		})
+	}
+	return report, nil
+}
@@ -0,0 +1,312 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errInsufficientStock = errors.New("insufficient stock")
+
+// AddIngredient 添加原料，初始库存为 0，通过入库调整
+func AddIngredient(ctx *gin.Context) {
+	var ingredient Ingredient
+	if ok := BindJSON(ctx, &ingredient); !ok {
+		return
+	}
+	ingredient.ID = 0
+	ingredient.OnHand = 0
+	if ok := CreateDataWithoutBind(ctx, &ingredient); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, ingredient)
+}
+
+// GetAllIngredients 获取所有原料及库存
+func GetAllIngredients(ctx *gin.Context) {
+	var ingredients []Ingredient
+	if ok := GetAllDatas(ctx, &ingredients, nil); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, ingredients)
+}
+
+// UpdateIngredient 更新原料名称、单位和补货线，库存只能通过出入库调整
+func UpdateIngredient(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var ingredient Ingredient
+	if ok := GetData(ctx, &ingredient, map[string]interface{}{"id": id}); !ok {
+		return
+	}
+	ingredientID, onHand := ingredient.ID, ingredient.OnHand
+	if ok := BindJSON(ctx, &ingredient); !ok {
+		return
+	}
+	ingredient.ID, ingredient.OnHand = ingredientID, onHand
+	if err := global.DB.Select("name", "unit", "reorder_level").Updates(&ingredient).Error; err != nil {
+		log.Println()
+		log.Printf("Update ingredient error\n")
+		log.Printf("ingredient: %+v\n", ingredient)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "更新失败",
+		})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, ingredient)
+}
+
+// DeleteIngredient 删除原料，仍被配方使用时拒绝删除，流水保留
+func DeleteIngredient(ctx *gin.Context) {
+	id := ctx.Param("id")
+	iid, _ := strconv.Atoi(id)
+	var used int64
+	if err := global.DB.Model(&RecipeItem{}).Where("ingredient_id = ?", iid).Count(&used).Error; err != nil {
+		log.Println()
+		log.Printf("Count recipe items error\n")
+		log.Printf("ingredient: %s\n", id)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询配方失败",
+		})
+		return
+	}
+	if used > 0 {
+		ctx.IndentedJSON(http.StatusConflict, gin.H{
+			"error": "原料仍在配方中使用，请先修改配方",
+		})
+		return
+	}
+	ingredient := Ingredient{ID: uint(iid)}
+	if ok := DeleteData(ctx, &ingredient); !ok {
+		return
+	}
+	log.Println()
+	log.Printf("Delete ingredient: %s\n", id)
+	ctx.IndentedJSON(http.StatusNoContent, nil)
+}
+
+// AdjustIngredient 手动出入库，请求体为 {"Type", "Quantity", "Note"}，操作记在当前登录用户名下
+//
+// 备注：
+//
+//	delivery 入库 Quantity 份，waste 报损 Quantity 份，count 盘点后库存修正为 Quantity；
+//	每次调整都写入一条流水，报损超过现有库存返回 409
+func AdjustIngredient(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var input struct {
+		Type     string `binding:"required"`
+		Quantity int64
+		Note     string
+	}
+	if ok := BindJSON(ctx, &input); !ok {
+		return
+	}
+	if !IsManualMovement(input.Type) || input.Quantity < 0 ||
+		(input.Type != MovementCount && input.Quantity == 0) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": "调整类型应为 delivery、waste 或 count，数量不能为负",
+		})
+		return
+	}
+
+	var movement StockMovement
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		// 加行锁，防止和下单扣减交错
+		var ingredient Ingredient
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&ingredient, id).Error; err != nil {
+			return err
+		}
+		change := input.Quantity
+		switch input.Type {
+		case MovementWaste:
+			change = -input.Quantity
+			if ingredient.OnHand < input.Quantity {
+				return errInsufficientStock
+			}
+		case MovementCount:
+			change = input.Quantity - ingredient.OnHand
+		}
+		if err := tx.Model(&ingredient).Update("on_hand", gorm.Expr("on_hand + ?", change)).Error; err != nil {
+			return err
+		}
+		movement = StockMovement{
+			Type:     input.Type,
+			Quantity: change,
+			UserID:   CurrentUser(ctx).ID,
+			Note:     input.Note,
+		}
+		return addMovement(tx, ingredient.ID, &movement)
+	})
+	if err != nil {
+		log.Println()
+		log.Printf("Adjust ingredient error\n")
+		log.Printf("ingredient: %s, input: %+v\n", id, input)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{
+				"error": "原料不存在",
+			})
+		case errors.Is(err, errInsufficientStock):
+			ctx.IndentedJSON(http.StatusConflict, gin.H{
+				"error": "报损数量超过现有库存",
+			})
+		default:
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+				"error": "调整失败",
+			})
+		}
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, movement)
+}
+
+// GetStockMovements 分页查询出入库流水，按时间倒序
+// 支持查询参数 ingredient、type、order 进行筛选
+func GetStockMovements(ctx *gin.Context) {
+	db := global.DB.Model(&StockMovement{})
+	if ingredient := ctx.Query("ingredient"); ingredient != "" {
+		db = db.Where("ingredient_id = ?", ingredient)
+	}
+	if movementType := ctx.Query("type"); movementType != "" {
+		db = db.Where("type = ?", movementType)
+	}
+	if order := ctx.Query("order"); order != "" {
+		db = db.Where("order_id = ?", order)
+	}
+	// 下面 Count 和 Find 要复用同一组条件
+	db = db.Session(&gorm.Session{})
+
+	var total int64
+	var movements []StockMovement
+	page, size := GetPagination(ctx)
+	err := db.Count(&total).Error
+	if err == nil {
+		err = db.Order("id desc").
+			Offset((page - 1) * size).
+			Limit(size).
+			Find(&movements).Error
+	}
+	if err != nil {
+		log.Println()
+		log.Printf("Query stock movements error\n")
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询流水失败",
+		})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"total":     total,
+		"movements": movements,
+	})
+}
+
+// GetRecipe 获取菜品配方
+func GetRecipe(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var dish Dish
+	if ok := GetData(ctx, &dish, map[string]interface{}{"id": id}); !ok {
+		return
+	}
+	var recipe []RecipeItem
+	if ok := GetAllDatas(ctx, &recipe, map[string]interface{}{"dish_id": dish.ID}); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, recipe)
+}
+
+// UpdateRecipe 设置菜品配方，请求体为 [{"IngredientID", "Quantity"}]，整体替换原有配方，空数组表示不扣原料
+func UpdateRecipe(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var dish Dish
+	if ok := GetData(ctx, &dish, map[string]interface{}{"id": id}); !ok {
+		return
+	}
+	var recipe []RecipeItem
+	if ok := BindJSON(ctx, &recipe); !ok {
+		return
+	}
+	ingredientIDs := make([]uint, 0, len(recipe))
+	seen := map[uint]bool{}
+	for i := range recipe {
+		if recipe[i].Quantity <= 0 || seen[recipe[i].IngredientID] {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+				"error": "原料用量必须大于0，且同一原料只能出现一次",
+			})
+			return
+		}
+		seen[recipe[i].IngredientID] = true
+		recipe[i].ID = 0
+		recipe[i].DishID = dish.ID
+		ingredientIDs = append(ingredientIDs, recipe[i].IngredientID)
+	}
+
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&Ingredient{}).Where("id IN ?", ingredientIDs).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(ingredientIDs) {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Where("dish_id = ?", dish.ID).Delete(&RecipeItem{}).Error; err != nil {
+			return err
+		}
+		if len(recipe) == 0 {
+			return nil
+		}
+		return tx.Create(&recipe).Error
+	})
+	if err != nil {
+		log.Println()
+		log.Printf("Update recipe error\n")
+		log.Printf("dish: %d, recipe: %+v\n", dish.ID, recipe)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+				"error": "原料不存在",
+			})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+				"error": "更新失败",
+			})
+		}
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, recipe)
+}
+
+// LowStockItem 低库存报表中的一项
+type LowStockItem struct {
+	Ingredient
+	Dishes []string // 因该原料不足一份而无法售卖的菜品
+}
+
+// GetLowStockReport 低库存报表：库存不高于补货线的原料，以及因此无法售卖的菜品
+func GetLowStockReport(ctx *gin.Context) {
+	report, err := LowStockReport(global.DB)
+	if err != nil {
+		log.Println()
+		log.Printf("Query low stock error\n")
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询失败",
+		})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, report)
+}
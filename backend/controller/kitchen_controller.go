@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// kitchenHeartbeat 心跳间隔，防止代理断开空闲连接
+const kitchenHeartbeat = 15 * time.Second
+
+var kitchenUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return MyAllowOriginFunc(r.Header.Get("Origin"))
+	},
+}
+
+// kitchenLastEventID 读取断线前收到的最后一个事件 ID，
+// EventSource 重连时会自动带上 Last-Event-ID 请求头，WebSocket 用查询参数 last_event_id
+func kitchenLastEventID(ctx *gin.Context) uint64 {
+	value := ctx.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = ctx.Query("last_event_id")
+	}
+	id, _ := strconv.ParseUint(value, 10, 64)
+	return id
+}
+
+// kitchenStationID 读取查询参数 station（工位 ID），为空表示所有工位
+func kitchenStationID(ctx *gin.Context) uint {
+	id, _ := strconv.ParseUint(ctx.Query("station"), 10, 64)
+	return uint(id)
+}
+
+// KitchenFeedSSE 以 Server-Sent Events 推送后厨事件
+// 查询参数 station 按工位 ID 过滤
+func KitchenFeedSSE(ctx *gin.Context) {
+	station := kitchenStationID(ctx)
+	ch, missed := SubscribeKitchen(kitchenLastEventID(ctx))
+	defer UnsubscribeKitchen(ch)
+
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("X-Accel-Buffering", "no") // 关闭 nginx 缓冲
+	send := func(event KitchenEvent) {
+		if filtered, ok := event.ForStation(station); ok {
+			ctx.Render(-1, sse.Event{
+				Id:    strconv.FormatUint(filtered.ID, 10),
+				Event: filtered.Type,
+				Data:  filtered,
+			})
+		}
+	}
+
+	heartbeat := time.NewTicker(kitchenHeartbeat)
+	defer heartbeat.Stop()
+	ctx.Stream(func(w io.Writer) bool {
+		for _, event := range missed {
+			send(event)
+		}
+		missed = nil
+		select {
+		case event, ok := <-ch:
+			// 处理不过来被断开，浏览器会带 Last-Event-ID 自动重连
+			if !ok {
+				return false
+			}
+			send(event)
+		case <-heartbeat.C:
+			io.WriteString(w, ": ping\n\n")
+		case <-ctx.Request.Context().Done():
+			return false
+		}
+		return true
+	})
+}
+
+// KitchenFeedWS 以 WebSocket 推送后厨事件，每条消息为一个 KitchenEvent 的 JSON
+// 查询参数 station 按工位 ID 过滤，last_event_id 用于断线续传
+func KitchenFeedWS(ctx *gin.Context) {
+	station := kitchenStationID(ctx)
+	conn, err := kitchenUpgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		log.Printf("Upgrade websocket error: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	ch, missed := SubscribeKitchen(kitchenLastEventID(ctx))
+	defer UnsubscribeKitchen(ch)
+
+	// 读取客户端消息以便及时发现断开，客户端不需要发送内容
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(event KitchenEvent) bool {
+		filtered, ok := event.ForStation(station)
+		if !ok {
+			return true
+		}
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteJSON(filtered) == nil
+	}
+	for _, event := range missed {
+		if !send(event) {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(kitchenHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-ch:
+			// 处理不过来被断开，客户端带 last_event_id 重连后续传
+			if !ok || !send(event) {
+				return
+			}
+		case <-heartbeat.C:
+			deadline := time.Now().Add(10 * time.Second)
+			if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
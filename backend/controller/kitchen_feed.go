@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"example.com/m/v2/global"
+)
+
+// 后厨推送的事件类型
+const (
+	KitchenEventOrderCreated   = "order.created"   // 新订单
+	KitchenEventOrderStatus    = "order.status"    // 订单状态变更
+	KitchenEventOrderCancelled = "order.cancelled" // 订单取消或作废
+	KitchenEventItemChanged    = "item.changed"    // 菜品明细变更
+	KitchenEventResync         = "resync"          // 断线太久无法续传，客户端需重新拉取订单
+)
+
+// kitchenBufferSize 保留最近的事件数量，断线重连时从中续传
+const kitchenBufferSize = 1000
+
+// KitchenItem 后厨看到的一道菜
+type KitchenItem struct {
+	RecordID  uint
+	DishID    uint
+	Name      string
+	Category  string
+	Count     int
+	Options   []string
+	StationID uint
+	Status    string
+}
+
+// KitchenEvent 推送给后厨的事件
+type KitchenEvent struct {
+	ID      uint64
+	Type    string
+	OrderID uint
+	TableNo string
+	Status  string
+	Items   []KitchenItem
+	Time    time.Time
+}
+
+// ForStation 按工位过滤事件中的菜品，stationID 为 0 表示不过滤
+// 事件中没有属于该工位的菜品时返回 false
+func (event *KitchenEvent) ForStation(stationID uint) (KitchenEvent, bool) {
+	if stationID == 0 || event.Type == KitchenEventResync {
+		return *event, true
+	}
+	filtered := *event
+	filtered.Items = make([]KitchenItem, 0, len(event.Items))
+	for _, item := range event.Items {
+		if item.StationID == stationID {
+			filtered.Items = append(filtered.Items, item)
+		}
+	}
+	return filtered, len(filtered.Items) > 0
+}
+
+// kitchenHub 事件中心：保存最近的事件并分发给所有订阅者
+type kitchenHub struct {
+	mu          sync.Mutex
+	nextID      uint64
+	buffer      []KitchenEvent // 环形缓冲
+	subscribers map[chan KitchenEvent]struct{}
+}
+
+var kitchenFeed = &kitchenHub{
+	// 以启动时间作为起始 ID，重启后 ID 仍然递增，旧的 Last-Event-ID 不会误匹配
+	nextID:      uint64(time.Now().UnixMilli()) * 1000,
+	buffer:      make([]KitchenEvent, 0, kitchenBufferSize),
+	subscribers: map[chan KitchenEvent]struct{}{},
+}
+
+// PublishKitchenEvent 分配 ID 并推送事件
+// 订阅者处理不过来时关闭它的 channel，连接随之断开，客户端带 Last-Event-ID 重连后从缓冲续传，不会漏单
+func PublishKitchenEvent(event KitchenEvent) {
+	hub := kitchenFeed
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	hub.nextID++
+	event.ID = hub.nextID
+	event.Time = time.Now()
+	if len(hub.buffer) < kitchenBufferSize {
+		hub.buffer = append(hub.buffer, event)
+	} else {
+		copy(hub.buffer, hub.buffer[1:])
+		hub.buffer[len(hub.buffer)-1] = event
+	}
+	for ch := range hub.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Kitchen subscriber is too slow at event %d, disconnect it\n", event.ID)
+			delete(hub.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// SubscribeKitchen 订阅事件，同时返回 lastID 之后错过的事件
+// lastID 不在缓冲中时（断线太久或服务重启过），错过的事件只有一个 resync；
+// 订阅者处理不过来时 channel 会被关闭，调用方收到关闭后应断开连接
+func SubscribeKitchen(lastID uint64) (chan KitchenEvent, []KitchenEvent) {
+	hub := kitchenFeed
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	ch := make(chan KitchenEvent, 64)
+	hub.subscribers[ch] = struct{}{}
+
+	var missed []KitchenEvent
+	if lastID > 0 && lastID != hub.nextID {
+		if len(hub.buffer) == 0 || lastID+1 < hub.buffer[0].ID || lastID > hub.nextID {
+			missed = []KitchenEvent{{ID: hub.nextID, Type: KitchenEventResync, Time: time.Now()}}
+		} else {
+			for _, event := range hub.buffer {
+				if event.ID > lastID {
+					missed = append(missed, event)
+				}
+			}
+		}
+	}
+	return ch, missed
+}
+
+// UnsubscribeKitchen 取消订阅，已被关闭的订阅者不会重复关闭
+func UnsubscribeKitchen(ch chan KitchenEvent) {
+	hub := kitchenFeed
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	delete(hub.subscribers, ch)
+}
+
+// PublishOrderEvent 读取订单及其菜品并推送给后厨，失败只记录日志，不影响业务
+func PublishOrderEvent(eventType string, orderID uint) {
+	publishKitchenOrder(eventType, orderID, 0)
+}
+
+// PublishItemEvent 推送订单中一道菜的变更
+func PublishItemEvent(orderID uint, recordID uint) {
+	publishKitchenOrder(KitchenEventItemChanged, orderID, recordID)
+}
+
+// publishKitchenOrder 推送订单事件，recordID 不为 0 时只包含这一道菜
+func publishKitchenOrder(eventType string, orderID uint, recordID uint) {
+	var order Order
+	preload := global.DB.Preload("Records.Options")
+	if recordID != 0 {
+		preload = global.DB.Preload("Records", "id = ?", recordID).Preload("Records.Options")
+	}
+	if err := preload.First(&order, orderID).Error; err != nil {
+		log.Printf("Publish kitchen event error, order: %d, error: %v\n", orderID, err)
+		return
+	}
+	items, err := BuildKitchenItems(order.Records)
+	if err != nil {
+		log.Printf("Publish kitchen event error, order: %d, error: %v\n", orderID, err)
+		return
+	}
+	PublishKitchenEvent(KitchenEvent{
+		Type:    eventType,
+		OrderID: order.ID,
+		TableNo: order.TableNo,
+		Status:  order.Status,
+		Items:   items,
+	})
+}
+
+// BuildKitchenItems 把订单明细转换为后厨看到的菜品，补充菜名和分类
+func BuildKitchenItems(records []Record) ([]KitchenItem, error) {
+	dishIDs := make([]uint, 0, len(records))
+	for _, record := range records {
+		dishIDs = append(dishIDs, record.DishID)
+	}
+	var dishes []Dish
+	if err := global.DB.Find(&dishes, dishIDs).Error; err != nil {
+		return nil, err
+	}
+	categories, err := LoadCategoryTree(global.DB)
+	if err != nil {
+		return nil, err
+	}
+	dishMap := make(map[uint]*Dish, len(dishes))
+	for i := range dishes {
+		dishMap[dishes[i].ID] = &dishes[i]
+	}
+
+	items := make([]KitchenItem, 0, len(records))
+	for _, record := range records {
+		item := KitchenItem{
+			RecordID:  record.ID,
+			DishID:    record.DishID,
+			Count:     record.Count,
+			Options:   make([]string, 0, len(record.Options)),
+			StationID: record.StationID,
+			Status:    record.Status,
+		}
+		if dish, ok := dishMap[record.DishID]; ok {
+			item.Name = dish.Name
+			item.Category = categories.Name(dish.CategoryID)
+		}
+		for _, option := range record.Options {
+			item.Options = append(item.Options, option.Name)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,115 @@
+package controller
+
+import "testing"
+
+// useKitchenHub 在测试期间使用新的事件中心，startID 为重启后的起始 ID
+func useKitchenHub(t *testing.T, startID uint64) {
+	t.Helper()
+	saved := kitchenFeed
+	t.Cleanup(func() { kitchenFeed = saved })
+	kitchenFeed = &kitchenHub{
+		nextID:      startID,
+		buffer:      make([]KitchenEvent, 0, kitchenBufferSize),
+		subscribers: map[chan KitchenEvent]struct{}{},
+	}
+}
+
+func TestSubscribeKitchenMissed(t *testing.T) {
+	useKitchenHub(t, 1000)
+	for i := 0; i < 3; i++ {
+		PublishKitchenEvent(KitchenEvent{Type: KitchenEventOrderCreated, OrderID: uint(i + 1)})
+	}
+	// 缓冲中为 1001、1002、1003
+	tests := []struct {
+		name   string
+		lastID uint64
+		want   []uint64
+		resync bool
+	}{
+		{"新连接", 0, nil, false},
+		{"续传", 1001, []uint64{1002, 1003}, false},
+		{"从最早的事件之前续传", 1000, []uint64{1001, 1002, 1003}, false},
+		{"没有错过", 1003, nil, false},
+		{"早于缓冲", 999, nil, true},
+		{"重启前的 ID", 5000, nil, true},
+	}
+	for _, tt := range tests {
+		ch, missed := SubscribeKitchen(tt.lastID)
+		UnsubscribeKitchen(ch)
+		if tt.resync {
+			if len(missed) != 1 || missed[0].Type != KitchenEventResync {
+				t.Errorf("%s: SubscribeKitchen(%d) = %+v, want a single resync", tt.name, tt.lastID, missed)
+			}
+			continue
+		}
+		if len(missed) != len(tt.want) {
+			t.Errorf("%s: SubscribeKitchen(%d) returned %d events, want %v", tt.name, tt.lastID, len(missed), tt.want)
+			continue
+		}
+		for i, id := range tt.want {
+			if missed[i].ID != id {
+				t.Errorf("%s: missed[%d].ID = %d, want %d", tt.name, i, missed[i].ID, id)
+			}
+		}
+	}
+}
+
+func TestSubscribeKitchenAfterRestart(t *testing.T) {
+	// 重启后缓冲为空，之前收到的事件无法续传
+	useKitchenHub(t, 2000)
+	ch, missed := SubscribeKitchen(1500)
+	UnsubscribeKitchen(ch)
+	if len(missed) != 1 || missed[0].Type != KitchenEventResync {
+		t.Fatalf("SubscribeKitchen() = %+v, want a single resync", missed)
+	}
+	// 收到 resync 后带它的 ID 重连，不会再次 resync
+	ch, missed = SubscribeKitchen(missed[0].ID)
+	UnsubscribeKitchen(ch)
+	if len(missed) != 0 {
+		t.Errorf("SubscribeKitchen() after resync = %+v, want none", missed)
+	}
+}
+
+func TestPublishKitchenEventSlowSubscriber(t *testing.T) {
+	useKitchenHub(t, 1000)
+	slow, _ := SubscribeKitchen(0)
+	defer UnsubscribeKitchen(slow)
+	for i := 0; i <= cap(slow); i++ {
+		PublishKitchenEvent(KitchenEvent{Type: KitchenEventItemChanged, OrderID: 1})
+	}
+	// 处理不过来时关闭，而不是悄悄丢弃事件
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != cap(slow) {
+		t.Errorf("received %d events before close, want %d", received, cap(slow))
+	}
+	if _, ok := kitchenFeed.subscribers[slow]; ok {
+		t.Error("slow subscriber is still subscribed")
+	}
+}
+
+func TestKitchenEventForStation(t *testing.T) {
+	event := KitchenEvent{
+		Type: KitchenEventOrderCreated,
+		Items: []KitchenItem{
+			{RecordID: 1, StationID: 1},
+			{RecordID: 2, StationID: 2},
+			{RecordID: 3, StationID: 1},
+		},
+	}
+	if filtered, ok := event.ForStation(0); !ok || len(filtered.Items) != 3 {
+		t.Errorf("ForStation(0) = %+v, %v; want all items", filtered, ok)
+	}
+	if filtered, ok := event.ForStation(1); !ok || len(filtered.Items) != 2 {
+		t.Errorf("ForStation(1) = %+v, %v; want 2 items", filtered, ok)
+	}
+	if _, ok := event.ForStation(3); ok {
+		t.Error("ForStation(3) = true, want false for a station without items")
+	}
+	resync := KitchenEvent{Type: KitchenEventResync}
+	if _, ok := resync.ForStation(3); !ok {
+		t.Error("resync should be sent to every station")
+	}
+}
@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// checkMenu 校验菜单的时区、时段、节假日和菜品设置
+func checkMenu(ctx *gin.Context, menu *Menu) bool {
+	msg := ""
+	validClock := func(clock string) bool {
+		_, err := time.Parse("15:04", clock)
+		return err == nil && len(clock) == 5
+	}
+	if menu.Timezone != "" {
+		if _, err := time.LoadLocation(menu.Timezone); err != nil {
+			msg = "无效的时区"
+		}
+	}
+	for _, window := range menu.Windows {
+		for _, day := range window.Weekdays {
+			if day < '0' || day > '6' {
+				msg = "星期应为 0-6 的数字，0 为周日"
+			}
+		}
+		if window.Weekdays == "" || !validClock(window.Start) || !validClock(window.End) || window.Start == window.End {
+			msg = "时段需要星期和不同的开始、结束时间（HH:MM）"
+		}
+	}
+	for _, holiday := range menu.Holidays {
+		if _, err := time.Parse("2006-01-02", holiday.Date); err != nil {
+			msg = "节假日日期格式应为 2006-01-02"
+		}
+		if !holiday.Closed && (holiday.Start != "" || holiday.End != "") &&
+			(!validClock(holiday.Start) || !validClock(holiday.End) || holiday.Start == holiday.End) {
+			msg = "节假日开放时段需要不同的开始、结束时间（HH:MM）"
+		}
+	}
+	for _, item := range menu.Items {
+		if (item.CategoryID == 0) == (item.DishID == 0) {
+			msg = "菜单中的每一项需要指定分类或菜品之一"
+		}
+	}
+	if msg != "" {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": msg,
+		})
+		return false
+	}
+	return true
+}
+
+// resetMenuChildren 清空子项的 ID 并指向 menuID，用于创建和整体替换
+func resetMenuChildren(menu *Menu, menuID uint) {
+	for i := range menu.Windows {
+		menu.Windows[i].ID, menu.Windows[i].MenuID = 0, menuID
+	}
+	for i := range menu.Holidays {
+		menu.Holidays[i].ID, menu.Holidays[i].MenuID = 0, menuID
+	}
+	for i := range menu.Items {
+		menu.Items[i].ID, menu.Items[i].MenuID = 0, menuID
+	}
+}
+
+// AddMenu 添加菜单，请求体中的 Windows、Holidays、Items 一起创建，未提供 Active 时默认启用
+func AddMenu(ctx *gin.Context) {
+	menu := Menu{Active: true}
+	if ok := BindJSON(ctx, &menu); !ok {
+		return
+	}
+	menu.ID = 0
+	resetMenuChildren(&menu, 0)
+	if ok := checkMenu(ctx, &menu); !ok {
+		return
+	}
+	if ok := CreateDataWithoutBind(ctx, &menu); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, menu)
+}
+
+// GetAllMenus 获取所有菜单及其时段、节假日和菜品
+func GetAllMenus(ctx *gin.Context) {
+	var menus []Menu
+	if ok := GetAllDatas(ctx, &menus, nil, "Windows", "Holidays", "Items"); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, menus)
+}
+
+// UpdateMenu 更新菜单，请求体中的 Windows、Holidays、Items 会整体替换原有设置
+func UpdateMenu(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var menu Menu
+	if ok := GetData(ctx, &menu, map[string]interface{}{"id": id}); !ok {
+		return
+	}
+	menuID := menu.ID
+	if ok := BindJSON(ctx, &menu); !ok {
+		return
+	}
+	menu.ID = menuID
+	resetMenuChildren(&menu, menuID)
+	if ok := checkMenu(ctx, &menu); !ok {
+		return
+	}
+
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("name", "timezone", "active").
+			Omit("Windows", "Holidays", "Items").Updates(&menu).Error; err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&MenuWindow{}, &MenuHoliday{}, &MenuItem{}} {
+			if err := tx.Where("menu_id = ?", menuID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if len(menu.Windows) > 0 {
+			if err := tx.Create(&menu.Windows).Error; err != nil {
+				return err
+			}
+		}
+		if len(menu.Holidays) > 0 {
+			if err := tx.Create(&menu.Holidays).Error; err != nil {
+				return err
+			}
+		}
+		if len(menu.Items) > 0 {
+			return tx.Create(&menu.Items).Error
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println()
+		log.Printf("Update menu error\n")
+		log.Printf("menu: %+v\n", menu)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "更新失败",
+		})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, menu)
+}
+
+// DeleteMenu 删除菜单及其时段、节假日和菜品，原属于该菜单的菜品恢复全天供应
+func DeleteMenu(ctx *gin.Context) {
+	id := ctx.Param("id")
+	iid, _ := strconv.Atoi(id)
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&MenuWindow{}, &MenuHoliday{}, &MenuItem{}} {
+			if err := tx.Where("menu_id = ?", iid).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&Menu{ID: uint(iid)}).Error
+	})
+	if err != nil {
+		log.Println()
+		log.Printf("Delete menu error\n")
+		log.Printf("menu: %s\n", id)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "删除错误",
+		})
+		return
+	}
+	log.Println()
+	log.Printf("Delete menu: %s\n", id)
+	ctx.IndentedJSON(http.StatusNoContent, nil)
+}
+
+// PreviewMenu 预览某一时刻顾客看到的菜单
+// 查询参数 at 为 RFC 3339 时间，如 2026-10-19T12:00:00+08:00，为空时使用当前时间
+func PreviewMenu(ctx *gin.Context) {
+	at := time.Now()
+	if value := ctx.Query("at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+				"error": "时间格式应为 RFC 3339，如 2026-10-19T12:00:00+08:00",
+			})
+			return
+		}
+		at = parsed
+	}
+	var dishes []Dish
+	if ok := GetAllDatas(ctx, &dishes, nil); !ok {
+		return
+	}
+	schedule, ok := loadMenuSchedule(ctx)
+	if !ok {
+		return
+	}
+	menus := make([]gin.H, 0, len(schedule.menus))
+	for i := range schedule.menus {
+		menus = append(menus, gin.H{
+			"id":   schedule.menus[i].ID,
+			"name": schedule.menus[i].Name,
+			"open": schedule.menus[i].OpenAt(at),
+		})
+	}
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"at":     at,
+		"menus":  menus,
+		"dishes": schedule.Filter(dishes, at),
+	})
+}
+
+// loadMenuSchedule 加载菜单安排，失败时已写入错误响应
+func loadMenuSchedule(ctx *gin.Context) (*MenuSchedule, bool) {
+	schedule, err := LoadMenuSchedule(global.DB)
+	if err != nil {
+		log.Println()
+		log.Printf("Load menu schedule error\n")
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询菜单失败",
+		})
+		return nil, false
+	}
+	return schedule, true
+}
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"strings"
+	"time"
+
+	"example.com/m/v2/global"
+	"gorm.io/gorm"
+)
+
+// inClock 判断 "HH:MM" 格式的 clock 是否在 [start, end) 内，end 早于 start 表示跨天
+// "15:04" 格式可以直接按字符串比较
+func inClock(clock string, start string, end string) bool {
+	if start <= end {
+		return clock >= start && clock < end
+	}
+	return clock >= start || clock < end
+}
+
+// hasWeekday 判断 weekdays（如 "12345"）是否包含 weekday，0 为周日
+func hasWeekday(weekdays string, weekday time.Weekday) bool {
+	return strings.ContainsRune(weekdays, rune('0'+weekday))
+}
+
+// Location 菜单所在的时区，未配置时使用 yaml/menu.yaml 中的时区
+func (menu *Menu) Location() *time.Location {
+	if menu.location != nil {
+		return menu.location
+	}
+	menu.location = global.MENU_CONFIG.Location
+	if menu.Timezone != "" {
+		if location, err := time.LoadLocation(menu.Timezone); err == nil {
+			menu.location = location
+		}
+	}
+	return menu.location
+}
+
+// OpenAt 判断菜单在 t 时是否开放
+//
+// 备注：
+//
+//	当天有节假日覆盖时只看覆盖设置；跨天的时段从 Weekdays 中的那一天开始，
+//	如周五的 22:00 - 02:00 一直开放到周六 02:00
+func (menu *Menu) OpenAt(t time.Time) bool {
+	if !menu.Active {
+		return false
+	}
+	t = t.In(menu.Location())
+	date, clock := t.Format("2006-01-02"), t.Format("15:04")
+	for _, holiday := range menu.Holidays {
+		if holiday.Date != date {
+			continue
+		}
+		if holiday.Closed {
+			return false
+		}
+		return (holiday.Start == "" && holiday.End == "") || inClock(clock, holiday.Start, holiday.End)
+	}
+
+	weekday := t.Weekday()
+	yesterday := (weekday + 6) % 7
+	for _, window := range menu.Windows {
+		crosses := window.End < window.Start
+		if hasWeekday(window.Weekdays, weekday) && clock >= window.Start && (crosses || clock < window.End) {
+			return true
+		}
+		if crosses && hasWeekday(window.Weekdays, yesterday) && clock < window.End {
+			return true
+		}
+	}
+	return false
+}
+
+// MenuSchedule 所有启用的菜单，用于判断菜品在某一时刻是否供应
+type MenuSchedule struct {
+	menus      []Menu
+	byDish     map[uint][]*Menu
+	byCategory map[uint][]*Menu
+	categories *CategoryTree
+}
+
+// LoadMenuSchedule 加载所有启用的菜单及其时段和菜品
+func LoadMenuSchedule(db *gorm.DB) (*MenuSchedule, error) {
+	schedule := &MenuSchedule{
+		byDish:     map[uint][]*Menu{},
+		byCategory: map[uint][]*Menu{},
+	}
+	if err := db.Preload("Windows").Preload("Holidays").Preload("Items").
+		Where("active = ?", true).Find(&schedule.menus).Error; err != nil {
+		return nil, err
+	}
+	categories, err := LoadCategoryTree(db)
+	if err != nil {
+		return nil, err
+	}
+	schedule.categories = categories
+	for i := range schedule.menus {
+		menu := &schedule.menus[i]
+		for _, item := range menu.Items {
+			if item.DishID != 0 {
+				schedule.byDish[item.DishID] = append(schedule.byDish[item.DishID], menu)
+			} else if item.CategoryID != 0 {
+				schedule.byCategory[item.CategoryID] = append(schedule.byCategory[item.CategoryID], menu)
+			}
+		}
+	}
+	return schedule, nil
+}
+
+// Available 判断菜品在 t 时是否供应：不属于任何菜单时全天供应，否则所属菜单中任一开放即可
+// 菜单中的分类包括其子分类
+func (schedule *MenuSchedule) Available(dish *Dish, t time.Time) bool {
+	menus := schedule.byDish[dish.ID]
+	for _, categoryID := range schedule.categories.Lineage(dish.CategoryID) {
+		menus = append(menus[:len(menus):len(menus)], schedule.byCategory[categoryID]...)
+	}
+	if len(menus) == 0 {
+		return true
+	}
+	for _, menu := range menus {
+		if menu.OpenAt(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter 返回 dishes 中在 t 时供应的菜品
+func (schedule *MenuSchedule) Filter(dishes []Dish, t time.Time) []Dish {
+	available := make([]Dish, 0, len(dishes))
+	for i := range dishes {
+		if schedule.Available(&dishes[i], t) {
+			available = append(available, dishes[i])
+		}
+	}
+	return available
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMenuOpenAt(t *testing.T) {
+	shanghai := setMenuConfig(t, "Asia/Shanghai", "04:00")
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, shanghai) // 16 日为周五
+	}
+	lunch := Menu{
+		Active:  true,
+		Windows: []MenuWindow{{Weekdays: "12345", Start: "10:30", End: "14:00"}},
+		Holidays: []MenuHoliday{
+			{Date: "2026-10-19", Closed: true},
+			{Date: "2026-10-20", Start: "11:00", End: "13:00"},
+		},
+	}
+	lateNight := Menu{
+		Active:  true,
+		Windows: []MenuWindow{{Weekdays: "5", Start: "22:00", End: "02:00"}},
+	}
+	tests := []struct {
+		name string
+		menu Menu
+		t    time.Time
+		want bool
+	}{
+		{"工作日午市", lunch, at(16, 12, 0), true},
+		{"开始时刻", lunch, at(16, 10, 30), true},
+		{"结束时刻", lunch, at(16, 14, 0), false},
+		{"周末不开", lunch, at(17, 12, 0), false},
+		{"节假日休息", lunch, at(19, 12, 0), false},
+		{"节假日调整时段内", lunch, at(20, 12, 30), true},
+		{"节假日调整时段外", lunch, at(20, 13, 30), false},
+		{"停用的菜单", Menu{Windows: lunch.Windows}, at(16, 12, 0), false},
+		{"跨天时段当天", lateNight, at(16, 23, 0), true},
+		{"跨天时段次日凌晨", lateNight, at(17, 1, 59), true},
+		{"跨天时段结束", lateNight, at(17, 2, 0), false},
+		{"跨天时段只从周五开始", lateNight, at(17, 23, 0), false},
+		{"周五凌晨属于周四的时段", lateNight, at(16, 1, 0), false},
+		// UTC 04:00 为上海 12:00
+		{"按菜单时区换算", lunch, time.Date(2026, 10, 16, 4, 0, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		if got := tt.menu.OpenAt(tt.t); got != tt.want {
+			t.Errorf("%s: OpenAt(%s) = %v, want %v", tt.name, tt.t.Format(time.RFC3339), got, tt.want)
+		}
+	}
+}
+
+func TestMenuOpenAtTimezone(t *testing.T) {
+	setMenuConfig(t, "Asia/Shanghai", "04:00")
+	menu := Menu{
+		Active:   true,
+		Timezone: "Asia/Tokyo",
+		Windows:  []MenuWindow{{Weekdays: "0123456", Start: "11:00", End: "12:00"}},
+	}
+	// 上海 10:30 为东京 11:30
+	if at := time.Date(2026, 10, 16, 2, 30, 0, 0, time.UTC); !menu.OpenAt(at) {
+		t.Errorf("OpenAt(%s) = false, want true in menu timezone", at.Format(time.RFC3339))
+	}
+}
+
+func TestMenuScheduleAvailable(t *testing.T) {
+	shanghai := setMenuConfig(t, "Asia/Shanghai", "04:00")
+	lunch := &Menu{Active: true, Windows: []MenuWindow{{Weekdays: "12345", Start: "10:30", End: "14:00"}}}
+	schedule := &MenuSchedule{
+		byDish:     map[uint][]*Menu{3: {lunch}},
+		byCategory: map[uint][]*Menu{10: {lunch}},
+		categories: testCategories(),
+	}
+	noon, evening := time.Date(2026, 10, 16, 12, 0, 0, 0, shanghai), time.Date(2026, 10, 16, 19, 0, 0, 0, shanghai)
+	tests := []struct {
+		name string
+		dish Dish
+		t    time.Time
+		want bool
+	}{
+		{"不属于任何菜单全天供应", Dish{ID: 1, CategoryID: 1}, evening, true},
+		{"指定菜品在时段内", Dish{ID: 3, CategoryID: 1}, noon, true},
+		{"指定菜品在时段外", Dish{ID: 3, CategoryID: 1}, evening, false},
+		{"分类在时段外", Dish{ID: 4, CategoryID: 10}, evening, false},
+		{"子分类同样受上级分类的菜单限制", Dish{ID: 5, CategoryID: 11}, evening, false},
+		{"子分类在时段内", Dish{ID: 5, CategoryID: 11}, noon, true},
+	}
+	for _, tt := range tests {
+		if got := schedule.Available(&tt.dish, tt.t); got != tt.want {
+			t.Errorf("%s: Available() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,29 +1,298 @@
 package controller
 
+import "time"
+
 type Dish struct {
-	ID       uint `gorm:"primaryKey"`
-	Name     string
-	Price    int
-	Category string
-	Img      string
+	ID           uint `gorm:"primaryKey"`
+	Name         string
+	Price        Money             // 最小货币单位
+	CategoryID   uint              `gorm:"index"`
+	Sort         int               // 分类内的显示顺序，越小越靠前
+	Img          string            // 展示用的中图
+	ImgThumb     string            // 缩略图
+	ImgOriginal  string            // 原图
+	Available    bool              `gorm:"not null"`               // 是否上架，下架后不能点
+	SoldOut      bool              `gorm:"not null;default:false"` // 今日售罄，手动估清或库存用完，营业日切换时重置
+	DailyStock   int               // 每日份数，0 表示不限
+	Stock        int               // 今日剩余份数，DailyStock 为 0 时无意义
+	StockDay     string            `gorm:"size:10"` // Stock 和 SoldOut 所属的营业日
+	OptionGroups []DishOptionGroup `gorm:"foreignKey:DishID"`
+}
+
+type Category struct {
+	// 菜品分类，ParentID 不为空时为子分类
+	ID       uint   `gorm:"primaryKey"`
+	Name     string `gorm:"uniqueIndex;size:64" binding:"required"`
+	Sort     int    // 显示顺序，越小越靠前
+	Icon     string
+	Visible  bool  `gorm:"not null"` // 隐藏后该分类及子分类的菜品不显示也不能点
+	ParentID *uint `gorm:"index"`
+}
+
+type DishOptionGroup struct {
+	// 规格组，如 辣度、份量、加料
+	ID        uint `gorm:"primaryKey"`
+	DishID    uint `gorm:"index"`
+	Name      string
+	Multiple  bool         // 是否多选
+	Required  bool         // 是否必选
+	MinSelect int          // 最少选择数量
+	MaxSelect int          // 最多选择数量，0 表示不限（单选时为 1）
+	Options   []DishOption `gorm:"foreignKey:GroupID"`
+}
+
+type DishOption struct {
+	ID         uint `gorm:"primaryKey"`
+	GroupID    uint `gorm:"index"`
+	Name       string
+	PriceDelta Money // 加价，可以为负
 }
 
 type Record struct {
-	ID     uint `gorm:"primaryKey"`
-	DishID uint `gorm:"foreignKey:Dish.ID"`
-	Time   string
-	Count  int
+	// 订单明细，一道菜一条
+	ID       uint `gorm:"primaryKey"`
+	OrderID  uint `gorm:"index"`
+	DishID   uint `gorm:"foreignKey:Dish.ID"`
+	Time     string
+	Count    int
+	Price    Money          // 下单时的单价快照，已包含规格加价
+	Discount Money          // 该行分摊到的优惠
+	Options  []RecordOption `gorm:"foreignKey:RecordID"`
+	// 后厨制作进度
+	StationID uint   `gorm:"index"`
+	Status    string `gorm:"size:16;default:pending"`
+	StartedAt *time.Time
+	DoneAt    *time.Time
+}
+
+type RecordOption struct {
+	// 下单时选择的规格快照
+	ID         uint `gorm:"primaryKey"`
+	RecordID   uint `gorm:"index"`
+	OptionID   uint
+	Name       string
+	PriceDelta Money
+}
+
+type Order struct {
+	ID      uint   `gorm:"primaryKey"`
+	TableID uint   `gorm:"index"`
+	TableNo string // 下单时的桌号快照
+	Status  string
+	Guests  int // 就餐人数，顾客下单时填写，0 表示未填写
+	// 计入销售汇总表时的状态：空为未计入，paid 已计入，refunded 退款已冲销
+	RolledUp string `gorm:"size:16;not null;default:'';index"`
+	// 以下金额为下单时的计价快照，Total = Subtotal - Discount + 价外税 + ServiceCharge + Rounding
+	Currency      string `gorm:"size:3"`
+	Subtotal      Money
+	Discount      Money
+	Tax           Money // 含价内税和价外税
+	ServiceCharge Money
+	Rounding      Money
+	Total         Money
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Records       []Record          `gorm:"foreignKey:OrderID"`
+	Transitions   []OrderTransition `gorm:"foreignKey:OrderID"`
+	Promotions    []OrderPromotion  `gorm:"foreignKey:OrderID"`
+}
+
+type OrderPromotion struct {
+	// 订单使用的优惠
+	ID          uint `gorm:"primaryKey"`
+	OrderID     uint `gorm:"index"`
+	PromotionID uint `gorm:"index"`
+	Name        string
+	Amount      Money
+}
+
+type IdempotencyKey struct {
+	// 下单请求的幂等键，StatusCode 为 0 表示请求仍在处理中
+	ID          uint   `gorm:"primaryKey"`
+	Key         string `gorm:"column:idempotency_key;uniqueIndex;size:128"`
+	TableID     uint
+	RequestHash string `gorm:"size:64"` // 用于发现同一个 key 被用于不同的请求
+	OrderID     uint
+	StatusCode  int
+	Response    string `gorm:"type:text"`
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+}
+
+type Promotion struct {
+	ID     uint   `gorm:"primaryKey"`
+	Name   string `binding:"required"`
+	Type   string `binding:"required"`   // threshold / percent / nth_item，见 promotion.go
+	Code   string `gorm:"size:32;index"` // 优惠码，为空表示满足条件自动生效
+	Active bool   `gorm:"not null"`      // 没有数据库默认值，GORM 创建时才会写入 false
+	// 有效期和每日生效时段，为空表示不限
+	StartsAt   *time.Time
+	EndsAt     *time.Time
+	DailyStart string // 如 "14:00"
+	DailyEnd   string // 如 "17:00"，早于 DailyStart 表示跨天
+	UsageLimit int    // 总使用次数上限，0 表示不限
+	UsedCount  int
+	// 适用范围，都为空表示全部菜品
+	CategoryID uint
+	DishID     uint
+	// 规则参数
+	Threshold Money // threshold: 满多少
+	Amount    Money // threshold: 减多少
+	Percent   int64 // percent / nth_item: 优惠比例，基点，5000 表示减免 50%
+	Nth       int   // nth_item: 每第几件优惠
+}
+
+type OrderTransition struct {
+	// 订单状态变更记录
+	ID         uint `gorm:"primaryKey"`
+	OrderID    uint `gorm:"index"`
+	FromStatus string
+	ToStatus   string
+	UserID     uint // 0 表示顾客下单
+	Note       string
+	CreatedAt  time.Time
+}
+
+type RefreshToken struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex;size:64"` // 只保存哈希
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+type Table struct {
+	ID     uint   `gorm:"primaryKey"`
+	Number string `gorm:"uniqueIndex;size:32" binding:"required"` // 桌号，唯一
+	Area   string // 区域，如 大厅、包间
+	Seats  int
+	Active bool `gorm:"not null"` // 不能设数据库默认值，否则 GORM 创建时会忽略 false
+}
+
+type Station struct {
+	// 后厨工位，如 炒锅、凉菜、饭档
+	ID     uint           `gorm:"primaryKey"`
+	Name   string         `gorm:"uniqueIndex;size:64" binding:"required"`
+	Routes []StationRoute `gorm:"foreignKey:StationID"`
+}
+
+type StationRoute struct {
+	// 哪些菜由该工位制作，指定菜品优先于指定分类
+	ID         uint `gorm:"primaryKey"`
+	StationID  uint `gorm:"index"`
+	CategoryID uint
+	DishID     uint
+}
+
+type Menu struct {
+	// 供应时段菜单，如 午市盖饭、夜宵；菜品不属于任何启用的菜单时全天供应，
+	// 属于一个或多个菜单时，只在其中任一菜单开放时供应
+	ID       uint          `gorm:"primaryKey"`
+	Name     string        `gorm:"uniqueIndex;size:64" binding:"required"`
+	Timezone string        `gorm:"size:64"` // 为空时使用 yaml/menu.yaml 中的时区
+	Active   bool          `gorm:"not null"`
+	Windows  []MenuWindow  `gorm:"foreignKey:MenuID"`
+	Holidays []MenuHoliday `gorm:"foreignKey:MenuID"`
+	Items    []MenuItem    `gorm:"foreignKey:MenuID"`
+	location *time.Location
+}
+
+type MenuWindow struct {
+	// 每周开放时段，End 早于 Start 表示跨天，如 22:00 - 02:00
+	ID       uint   `gorm:"primaryKey"`
+	MenuID   uint   `gorm:"index"`
+	Weekdays string `gorm:"size:7"` // 开放的星期，0 为周日，如 "12345" 表示工作日
+	Start    string `gorm:"size:5"` // "HH:MM"
+	End      string `gorm:"size:5"`
+}
+
+type MenuHoliday struct {
+	// 节假日覆盖，当天不按每周时段，Closed 为 true 时全天不开放，否则按 Start - End 开放
+	ID     uint   `gorm:"primaryKey"`
+	MenuID uint   `gorm:"index"`
+	Date   string `gorm:"size:10"` // "2006-01-02"
+	Closed bool
+	Start  string `gorm:"size:5"` // 都为空表示全天开放
+	End    string `gorm:"size:5"`
+}
+
+type MenuItem struct {
+	// 菜单包含的菜品，指定分类或菜品之一
+	ID         uint `gorm:"primaryKey"`
+	MenuID     uint `gorm:"index"`
+	CategoryID uint
+	DishID     uint
+}
+
+type Ingredient struct {
+	// 原料，数量均以 Unit 表示的最小单位计，如 克、毫升、个
+	ID           uint   `gorm:"primaryKey"`
+	Name         string `gorm:"uniqueIndex;size:64" binding:"required"`
+	Unit         string `gorm:"size:16" binding:"required"`
+	OnHand       int64  // 现有库存，只能通过出入库调整
+	ReorderLevel int64  // 低于等于该数量时出现在低库存报表中
+}
+
+type RecipeItem struct {
+	// 配方，一份菜品消耗的原料数量
+	ID           uint  `gorm:"primaryKey"`
+	DishID       uint  `gorm:"index"`
+	IngredientID uint  `gorm:"index" binding:"required"`
+	Quantity     int64 `binding:"required"`
+}
+
+type StockMovement struct {
+	// 原料出入库流水，只增不改
+	ID           uint   `gorm:"primaryKey"`
+	IngredientID uint   `gorm:"index"`
+	Type         string `gorm:"size:16;index"`
+	Quantity     int64  // 变动数量，入库为正、出库为负
+	Balance      int64  // 变动后的库存
+	OrderID      uint   `gorm:"index"` // 下单扣减和取消退回时关联的订单
+	UserID       uint   // 手动调整的操作人
+	Note         string
+	CreatedAt    time.Time
+}
+
+type SalesRollup struct {
+	// 销售汇总表的公共字段，Dimension 为 total、dish、category、area，DimensionKey 为菜品 ID、分类 ID 或桌子区域
+	// 按订单汇总时 Revenue 为实收；按菜品、分类汇总时为分摊优惠后的销售额，Covers 为 0
+	Dimension    string `gorm:"size:16;uniqueIndex:idx_rollup"`
+	DimensionKey string `gorm:"size:64;uniqueIndex:idx_rollup"`
+	Revenue      Money
+	NetSales     Money
+	Orders       int
+	Covers       int
+	Items        int
+}
+
+type HourlySalesRollup struct {
+	// 按营业日和小时汇总的销售数据
+	ID          uint      `gorm:"primaryKey"`
+	Day         string    `gorm:"size:10;uniqueIndex:idx_rollup"` // 营业日
+	Hour        int       `gorm:"uniqueIndex:idx_rollup"`         // 营业时区的小时
+	Start       time.Time `gorm:"index"`                          // 该小时的开始时刻
+	SalesRollup `gorm:"embedded"`
+}
+
+type DailySalesRollup struct {
+	// 按营业日汇总的销售数据
+	ID          uint   `gorm:"primaryKey"`
+	Day         string `gorm:"size:10;uniqueIndex:idx_rollup"`
+	SalesRollup `gorm:"embedded"`
 }
 
 type Bill struct {
 	// no database
-	DishID uint
-	Count  int
+	DishID  uint
+	Count   int
+	Options []uint // 选择的规格 ID
 }
 
 type User struct {
 	ID       uint `gorm:"primaryKey"`
 	Username string
-	Password string
+	Password string `json:"-"`
 	Role     string
 }
@@ -0,0 +1,38 @@
+package controller
+
+import "fmt"
+
+// Money 金额，以最小货币单位存储（人民币为分），避免浮点误差
+// 币种由 yaml/pricing.yaml 的 currency 配置，订单上保存下单时的币种
+type Money int64
+
+// String 以元为单位格式化，如 1250 -> "12.50"
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		m = -m
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, m/100, m%100)
+}
+
+// MulRate 按基点（1/10000）计算比例金额，四舍五入到最小单位
+func (m Money) MulRate(rate int64) Money {
+	return divRound(int64(m)*rate, 10000)
+}
+
+// RoundTo 四舍五入到 unit 的整数倍，unit 不大于 1 时不舍入
+func (m Money) RoundTo(unit int64) Money {
+	if unit <= 1 {
+		return m
+	}
+	return divRound(int64(m), unit) * Money(unit)
+}
+
+// divRound 整数除法，四舍五入（远离零）
+func divRound(a int64, b int64) Money {
+	if a < 0 {
+		return -Money((-a + b/2) / b)
+	}
+	return Money((a + b/2) / b)
+}
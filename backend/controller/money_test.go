@@ -0,0 +1,86 @@
+package controller
+
+import "testing"
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{1250, "12.50"},
+		{100000, "1000.00"},
+		{-5, "-0.05"},
+		{-1250, "-12.50"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", int64(tt.m), got, tt.want)
+		}
+	}
+}
+
+func TestMoneyMulRate(t *testing.T) {
+	tests := []struct {
+		m    Money
+		rate int64
+		want Money
+	}{
+		{1000, 600, 60}, // 6%
+		{999, 600, 60},  // 59.94 -> 60
+		{1008, 600, 60}, // 60.48 -> 60
+		{1009, 600, 61}, // 60.54 -> 61
+		{25, 2000, 5},   // 正好
+		{5, 5000, 3},    // 2.5 远离零舍入
+		{-5, 5000, -3},  // 负数同样远离零
+		{1234, 10000, 1234},
+		{1234, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.m.MulRate(tt.rate); got != tt.want {
+			t.Errorf("Money(%d).MulRate(%d) = %d, want %d", int64(tt.m), tt.rate, int64(got), int64(tt.want))
+		}
+	}
+}
+
+func TestMoneyRoundTo(t *testing.T) {
+	tests := []struct {
+		m    Money
+		unit int64
+		want Money
+	}{
+		{1234, 0, 1234},
+		{1234, 1, 1234},
+		{1234, 10, 1230},
+		{1235, 10, 1240},
+		{1249, 50, 1250},
+		{1224, 50, 1200},
+		{-1235, 10, -1240},
+	}
+	for _, tt := range tests {
+		if got := tt.m.RoundTo(tt.unit); got != tt.want {
+			t.Errorf("Money(%d).RoundTo(%d) = %d, want %d", int64(tt.m), tt.unit, int64(got), int64(tt.want))
+		}
+	}
+}
+
+func TestDivRound(t *testing.T) {
+	tests := []struct {
+		a, b int64
+		want Money
+	}{
+		{10, 3, 3},
+		{11, 3, 4},
+		{15, 10, 2},
+		{14, 10, 1},
+		{-15, 10, -2},
+		{-14, 10, -1},
+		{0, 7, 0},
+	}
+	for _, tt := range tests {
+		if got := divRound(tt.a, tt.b); got != tt.want {
+			t.Errorf("divRound(%d, %d) = %d, want %d", tt.a, tt.b, int64(got), int64(tt.want))
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// checkOptionGroups 校验随菜品一起提交的规格组
+func checkOptionGroups(ctx *gin.Context, dish *Dish) bool {
+	for i := range dish.OptionGroups {
+		if ok := checkOptionGroup(ctx, &dish.OptionGroups[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// checkOptionGroup 校验规格组的选择数量设置是否自洽
+func checkOptionGroup(ctx *gin.Context, group *DishOptionGroup) bool {
+	msg := ""
+	switch {
+	case group.Name == "" || len(group.Options) == 0:
+		msg = "规格组需要名称和至少一个选项"
+	case group.MinSelect < 0 || group.MaxSelect < 0:
+		msg = "选择数量不能为负"
+	case !group.Multiple && group.MinSelect > 1:
+		msg = "单选规格组最少选择数量不能大于1"
+	case group.MaxSelect > 0 && group.MinSelect > group.MaxSelect:
+		msg = "最少选择数量不能大于最多选择数量"
+	case group.MinSelect > len(group.Options):
+		msg = "最少选择数量不能大于选项数量"
+	}
+	if msg != "" {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": msg,
+		})
+		return false
+	}
+	return true
+}
+
+// AddOptionGroup 为菜品添加规格组，请求体中的 Options 一起创建
+func AddOptionGroup(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var dish Dish
+	if ok := GetData(ctx, &dish, map[string]interface{}{"id": id}); !ok {
+		return
+	}
+	var group DishOptionGroup
+	if ok := BindJSON(ctx, &group); !ok {
+		return
+	}
+	group.ID = 0
+	group.DishID = dish.ID
+	for i := range group.Options {
+		group.Options[i].ID = 0
+	}
+	if ok := checkOptionGroup(ctx, &group); !ok {
+		return
+	}
+	if ok := CreateDataWithoutBind(ctx, &group); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, group)
+}
+
+// UpdateOptionGroup 更新规格组，请求体中的 Options 会整体替换原有选项
+func UpdateOptionGroup(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var group DishOptionGroup
+	if ok := GetData(ctx, &group, map[string]interface{}{"id": id}); !ok {
+		return
+	}
+	groupID, dishID := group.ID, group.DishID
+	if ok := BindJSON(ctx, &group); !ok {
+		return
+	}
+	group.ID, group.DishID = groupID, dishID
+	for i := range group.Options {
+		group.Options[i].ID = 0
+		group.Options[i].GroupID = groupID
+	}
+	if ok := checkOptionGroup(ctx, &group); !ok {
+		return
+	}
+
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("name", "multiple", "required", "min_select", "max_select").
+			Omit("Options").Updates(&group).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("group_id = ?", groupID).Delete(&DishOption{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&group.Options).Error
+	})
+	if err != nil {
+		log.Println()
+		log.Printf("Update option group error\n")
+		log.Printf("group: %+v\n", group)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "更新失败",
+		})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, group)
+}
+
+// DeleteOptionGroup 删除规格组及其选项
+func DeleteOptionGroup(ctx *gin.Context) {
+	id := ctx.Param("id")
+	iid, _ := strconv.Atoi(id)
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", iid).Delete(&DishOption{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&DishOptionGroup{ID: uint(iid)}).Error
+	})
+	if err != nil {
+		log.Println()
+		log.Printf("Delete option group error\n")
+		log.Printf("group: %s\n", id)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "删除错误",
+		})
+		return
+	}
+	log.Println()
+	log.Printf("Delete option group: %s\n", id)
+	ctx.IndentedJSON(http.StatusNoContent, nil)
+}
@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateOrder 先校验整个订单，再在同一个数据库事务中创建订单及其明细记录，
+// 任何一步失败都会整体回滚，不会留下半个订单
+//
+// 参数：
+//
+//	ctx *gin.Context: Gin 框架的上下文对象，用于返回错误响应
+//	order *Order: 待创建的订单，成功后会填充 ID、各项金额和 Records
+//	bills []Bill: 点菜明细
+//	coupon string: 优惠码，可以为空
+//	key *IdempotencyKey: 已占用的幂等键，可以为 nil，订单创建后在同一事务中保存响应
+//
+// 返回值：
+//
+//	bool: 创建成功返回 true；否则返回 false，并已写入错误响应
+func CreateOrder(ctx *gin.Context, order *Order, bills []Bill, coupon string, key *IdempotencyKey) bool {
+	now := time.Now().Format("2006-01-02 15:04:05")
+	// 在事务外重置，订单校验失败回滚时不会撤销重置
+	if err := ResetDailyStock(); err != nil {
+		RespondQuoteError(ctx, err)
+		return false
+	}
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		// 防止篡改价格，以数据库中的价格为准
+		quote, err := QuoteBills(tx, bills, coupon)
+		if err != nil {
+			return err
+		}
+		order.Promotions = make([]OrderPromotion, 0, len(quote.Promotions))
+		for _, applied := range quote.Promotions {
+			// 条件更新，并发下单也不会超过使用次数上限
+			result := tx.Model(&Promotion{}).
+				Where("id = ? AND (usage_limit = 0 OR used_count < usage_limit)", applied.PromotionID).
+				Update("used_count", gorm.Expr("used_count + 1"))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return &BillError{Line: -1, Msg: applied.Name + "已被领完"}
+			}
+			order.Promotions = append(order.Promotions, OrderPromotion{
+				PromotionID: applied.PromotionID,
+				Name:        applied.Name,
+				Amount:      applied.Amount,
+			})
+		}
+		if err := reserveStock(tx, quote); err != nil {
+			return err
+		}
+		router, err := loadStationRouter(tx)
+		if err != nil {
+			return err
+		}
+		for i := range quote.records {
+			quote.records[i].Time = now
+			quote.records[i].Status = ItemStatusPending
+			quote.records[i].StationID = router.StationFor(quote.dishes[i])
+		}
+		order.Records = quote.records
+		order.Currency = quote.Currency
+		order.Subtotal = quote.Subtotal
+		order.Discount = quote.Discount
+		order.Tax = quote.TaxTotal()
+		order.ServiceCharge = quote.ServiceCharge
+		order.Rounding = quote.Rounding
+		order.Total = quote.Total
+		// 会连同 Records 及其 Options、Promotions 一起创建
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		if err := consumeIngredients(tx, order, quote); err != nil {
+			return err
+		}
+		// 下单本身也记作一次状态变更
+		if err := tx.Create(&OrderTransition{
+			OrderID:  order.ID,
+			ToStatus: order.Status,
+		}).Error; err != nil {
+			return err
+		}
+		if key == nil {
+			return nil
+		}
+		return CompleteIdempotencyKey(tx, key, order.ID, http.StatusOK, SubmitOrderResponse(order))
+	})
+	if errors.Is(err, errIdempotencyLeaseLost) {
+		log.Println()
+		log.Printf("Create order error\n")
+		log.Printf("key: %s\n", key.Key)
+		log.Printf("error: %s\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusConflict, gin.H{
+			"error": "订单提交超时，请重新提交",
+		})
+		return false
+	}
+	if err != nil {
+		RespondQuoteError(ctx, err)
+		return false
+	}
+	return true
+}
+
+// GetOrder 根据订单 ID 获取订单及其明细，需要下单时返回的跟踪令牌
+//
+// 参数：
+//
+//	ctx *gin.Context: Gin 框架的上下文对象
+//
+// 返回值：
+//
+//	无
+func GetOrder(ctx *gin.Context) {
+	var order Order
+	if ok := GetOrderFromTrackingToken(ctx, &order, "Records.Options", "Promotions"); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, order)
+}
+
+// GetOrderDetail 获取订单及其明细和状态变更记录，供后台使用
+//
+// 参数：
+//
+//	ctx *gin.Context: Gin 框架的上下文对象
+//
+// 返回值：
+//
+//	无
+func GetOrderDetail(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var order Order
+	query := map[string]interface{}{"id": id}
+	if ok := GetData(ctx, &order, query, "Records.Options", "Promotions", "Transitions"); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, order)
+}
+
+// GetAllOrders 分页获取订单列表，按创建时间倒序
+// 支持查询参数 status、table 进行筛选，page、page_size 进行分页
+//
+// 参数：
+//
+//	ctx *gin.Context: Gin 框架的上下文对象
+//
+// 返回值：
+//
+//	无
+func GetAllOrders(ctx *gin.Context) {
+	db := global.DB.Model(&Order{})
+	if status := ctx.Query("status"); status != "" {
+		db = db.Where("status = ?", status)
+	}
+	if table := ctx.Query("table"); table != "" {
+		db = db.Where("table_no = ?", table)
+	}
+	// 下面 Count 和 Find 要复用同一组条件
+	db = db.Session(&gorm.Session{})
+
+	var total int64
+	var orders []Order
+	page, size := GetPagination(ctx)
+	err := db.Count(&total).Error
+	if err == nil {
+		err = db.Preload("Records.Options").Preload("Promotions").
+			Order("id desc").
+			Offset((page - 1) * size).
+			Limit(size).
+			Find(&orders).Error
+	}
+	if err != nil {
+		log.Println()
+		log.Printf("Query orders error\n")
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询订单失败",
+		})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"total":  total,
+		"orders": orders,
+	})
+}
+
+// TransitionOrder 变更订单状态，只允许状态机中定义的变更，非法变更返回 409
+//
+// 参数：
+//
+//	ctx *gin.Context: Gin 框架的上下文对象，请求体为 {"Status", "Note"}，变更记在当前登录用户名下
+//
+// 返回值：
+//
+//	无
+func TransitionOrder(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var input struct {
+		Status string `binding:"required"`
+		Note   string
+	}
+	if ok := BindJSON(ctx, &input); !ok {
+		return
+	}
+	if !IsOrderStatus(input.Status) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": "未知的订单状态",
+		})
+		return
+	}
+	perm, ok := transitionPermissions[input.Status]
+	if !ok {
+		perm = PermOrdersUpdate
+	}
+	if !HasPermission(CurrentUser(ctx), perm) {
+		ctx.IndentedJSON(http.StatusForbidden, gin.H{
+			"error":      "没有权限",
+			"permission": perm,
+		})
+		return
+	}
+	var order Order
+	query := map[string]interface{}{"id": id}
+	if ok := GetData(ctx, &order, query); !ok {
+		return
+	}
+	if ok := ChangeOrderStatus(ctx, &order, input.Status, CurrentUser(ctx).ID, input.Note); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, order)
+}
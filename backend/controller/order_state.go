@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 订单状态
+const (
+	OrderStatusPlaced    = "placed"    // 已下单
+	OrderStatusAccepted  = "accepted"  // 已接单
+	OrderStatusCooking   = "cooking"   // 制作中
+	OrderStatusServed    = "served"    // 已上菜
+	OrderStatusPaid      = "paid"      // 已支付
+	OrderStatusCancelled = "cancelled" // 出餐前取消
+	OrderStatusVoided    = "voided"    // 出餐后作废
+	OrderStatusRefunded  = "refunded"  // 支付后退款
+)
+
+// orderTransitions 状态机：每个状态允许变更到的下一个状态
+// 没有出现在 key 中的状态为终态
+var orderTransitions = map[string][]string{
+	OrderStatusPlaced:   {OrderStatusAccepted, OrderStatusCancelled},
+	OrderStatusAccepted: {OrderStatusCooking, OrderStatusCancelled},
+	OrderStatusCooking:  {OrderStatusServed, OrderStatusVoided},
+	OrderStatusServed:   {OrderStatusPaid, OrderStatusVoided},
+	OrderStatusPaid:     {OrderStatusRefunded},
+}
+
+var errIllegalTransition = errors.New("illegal order transition")
+
+// IsOrderStatus 判断 status 是否为已定义的订单状态
+func IsOrderStatus(status string) bool {
+	switch status {
+	case OrderStatusPlaced, OrderStatusAccepted, OrderStatusCooking, OrderStatusServed,
+		OrderStatusPaid, OrderStatusCancelled, OrderStatusVoided, OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+// CanTransition 判断订单能否从 from 变更到 to
+func CanTransition(from string, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangeOrderStatus 在事务中锁定订单行，校验并执行状态变更，同时写入变更记录，成功后推送给后厨
+//
+// 参数：
+//
+//	ctx *gin.Context: Gin 框架的上下文对象，用于返回错误响应
+//	order *Order: 要变更的订单，成功后会更新为最新状态
+//	to string: 目标状态
+//	userID uint: 执行变更的用户
+//	note string: 备注
+//
+// 返回值：
+//
+//	bool: 变更成功返回 true；否则返回 false，并已写入错误响应
+//
+// 备注：
+//
+//	非法变更返回 409，并在响应中给出当前状态和允许的目标状态
+func ChangeOrderStatus(ctx *gin.Context, order *Order, to string, userID uint, note string) bool {
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		// 加行锁，防止并发变更
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(order, order.ID).Error; err != nil {
+			return err
+		}
+		if !CanTransition(order.Status, to) {
+			return errIllegalTransition
+		}
+		transition := OrderTransition{
+			OrderID:    order.ID,
+			FromStatus: order.Status,
+			ToStatus:   to,
+			UserID:     userID,
+			Note:       note,
+		}
+		if err := tx.Model(order).Update("status", to).Error; err != nil {
+			return err
+		}
+		// 取消或作废的订单退回库存，作废后如有用掉的原料以报损记录
+		if to == OrderStatusCancelled || to == OrderStatusVoided {
+			if err := returnIngredients(tx, order.ID, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&transition).Error
+	})
+	if err != nil {
+		log.Println()
+		log.Printf("Change order status error\n")
+		log.Printf("order: %d, from: %s, to: %s\n", order.ID, order.Status, to)
+		log.Printf("error: %s\n", err.Error())
+		log.Println()
+		if errors.Is(err, errIllegalTransition) {
+			ctx.IndentedJSON(http.StatusConflict, gin.H{
+				"error":   "订单状态不允许此变更",
+				"status":  order.Status,
+				"allowed": orderTransitions[order.Status],
+			})
+		} else {
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+				"error": "订单状态变更失败",
+			})
+		}
+		return false
+	}
+
+	eventType := KitchenEventOrderStatus
+	if to == OrderStatusCancelled || to == OrderStatusVoided {
+		eventType = KitchenEventOrderCancelled
+	}
+	PublishOrderEvent(eventType, order.ID)
+	// 支付和退款计入销售汇总表
+	if to == OrderStatusPaid || to == OrderStatusRefunded {
+		NotifyRollup()
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package controller
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want bool
+	}{
+		{OrderStatusPlaced, OrderStatusAccepted, true},
+		{OrderStatusPlaced, OrderStatusCancelled, true},
+		{OrderStatusPlaced, OrderStatusCooking, false},
+		{OrderStatusPlaced, OrderStatusPaid, false},
+		{OrderStatusAccepted, OrderStatusCooking, true},
+		{OrderStatusAccepted, OrderStatusCancelled, true},
+		{OrderStatusAccepted, OrderStatusVoided, false},
+		{OrderStatusCooking, OrderStatusServed, true},
+		{OrderStatusCooking, OrderStatusVoided, true},
+		{OrderStatusCooking, OrderStatusCancelled, false},
+		{OrderStatusServed, OrderStatusPaid, true},
+		{OrderStatusServed, OrderStatusVoided, true},
+		{OrderStatusServed, OrderStatusPlaced, false},
+		{OrderStatusPaid, OrderStatusRefunded, true},
+		{OrderStatusPaid, OrderStatusVoided, false},
+		// 终态
+		{OrderStatusCancelled, OrderStatusPlaced, false},
+		{OrderStatusVoided, OrderStatusServed, false},
+		{OrderStatusRefunded, OrderStatusPaid, false},
+		// 未定义的状态
+		{"unknown", OrderStatusAccepted, false},
+		{OrderStatusPlaced, "unknown", false},
+		{OrderStatusPlaced, OrderStatusPlaced, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestIsOrderStatus(t *testing.T) {
+	for status := range orderStatusNames {
+		if !IsOrderStatus(status) {
+			t.Errorf("IsOrderStatus(%q) = false, want true", status)
+		}
+	}
+	for _, status := range []string{"", "unknown", "Paid"} {
+		if IsOrderStatus(status) {
+			t.Errorf("IsOrderStatus(%q) = true, want false", status)
+		}
+	}
+}
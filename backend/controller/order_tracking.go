@@ -0,0 +1,258 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"time"
+
+	"example.com/m/v2/global"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// OrderTokenHeader 顾客端携带订单跟踪令牌的请求头，也可以用查询参数 token
+const OrderTokenHeader = "X-Order-Token"
+
+// OrderTrackingToken 生成订单跟踪令牌，下单成功时返回给顾客，凭它查询订单进度
+func OrderTrackingToken(order *Order) string {
+	mac := hmac.New(sha256.New, []byte(global.TABLE_CONFIG.Secret))
+	fmt.Fprintf(mac, "order:%d:%d", order.ID, order.TableID)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// GetOrderFromTrackingToken 读取路径中的订单并校验跟踪令牌
+//
+// 参数：
+//
+//	ctx *gin.Context: Gin 框架的上下文对象
+//	order *Order: 校验通过后填充对应的订单
+//	preloads ...string: 需要一起加载的关联
+//
+// 返回值：
+//
+//	bool: 订单存在且令牌有效时返回 true；否则返回 false，并已写入错误响应
+func GetOrderFromTrackingToken(ctx *gin.Context, order *Order, preloads ...string) bool {
+	token := ctx.GetHeader(OrderTokenHeader)
+	if token == "" {
+		token = ctx.Query("token")
+	}
+	db := global.DB
+	for _, preload := range preloads {
+		db = db.Preload(preload)
+	}
+	// 订单不存在和令牌错误返回同样的结果，避免枚举订单号
+	if err := db.First(order, ctx.Param("id")).Error; err != nil ||
+		!hmac.Equal([]byte(token), []byte(OrderTrackingToken(order))) {
+		ctx.IndentedJSON(http.StatusForbidden, gin.H{
+			"error": "订单不存在或跟踪令牌无效",
+		})
+		return false
+	}
+	return true
+}
+
+// TrackingItem 顾客看到的一道菜的进度
+type TrackingItem struct {
+	Name   string
+	Count  int
+	Status string
+}
+
+// OrderTracking 顾客看到的订单进度
+type OrderTracking struct {
+	OrderID          uint
+	Status           string
+	Items            []TrackingItem
+	QueueAhead       int // 同工位排在前面还没做好的菜品份数
+	EstimatedMinutes int // 预计还需等待的分钟数，订单已上菜或结束时为 0
+}
+
+// orderActiveStatuses 后厨仍在处理的订单状态
+var orderActiveStatuses = []string{OrderStatusPlaced, OrderStatusAccepted, OrderStatusCooking}
+
+// orderFinished 订单已结束，不会再有进度变化
+func orderFinished(status string) bool {
+	return status == OrderStatusPaid || status == OrderStatusCancelled || status == OrderStatusVoided ||
+		status == OrderStatusRefunded
+}
+
+// BuildOrderTracking 汇总订单进度并根据后厨队列长度估算等待时间
+//
+// 备注：
+//
+//	按工位分别计算 (排在前面的份数 + 本单的份数) * 每份制作时间，取最长的工位作为预计等待时间
+func BuildOrderTracking(order *Order) (*OrderTracking, error) {
+	tracking := &OrderTracking{
+		OrderID: order.ID,
+		Status:  order.Status,
+		Items:   make([]TrackingItem, 0, len(order.Records)),
+	}
+	items, err := BuildKitchenItems(order.Records)
+	if err != nil {
+		return nil, err
+	}
+	own := map[uint]int{}
+	stationIDs := []uint{}
+	for i, item := range items {
+		tracking.Items = append(tracking.Items, TrackingItem{
+			Name:   item.Name,
+			Count:  item.Count,
+			Status: order.Records[i].Status,
+		})
+		if order.Records[i].Status == ItemStatusDone {
+			continue
+		}
+		if _, ok := own[item.StationID]; !ok {
+			stationIDs = append(stationIDs, item.StationID)
+		}
+		own[item.StationID] += item.Count
+	}
+
+	active := false
+	for _, status := range orderActiveStatuses {
+		active = active || order.Status == status
+	}
+	if !active || len(stationIDs) == 0 {
+		return tracking, nil
+	}
+
+	var queues []struct {
+		StationID uint
+		Total     int
+	}
+	err = global.DB.Model(&Record{}).
+		Select("records.station_id, SUM(records.count) AS total").
+		Joins("JOIN orders ON orders.id = records.order_id").
+		Where("records.station_id IN ?", stationIDs).
+		Where("records.status IN ?", []string{ItemStatusPending, ItemStatusStarted}).
+		Where("orders.status IN ?", orderActiveStatuses).
+		Where("records.order_id <= ?", order.ID).
+		Group("records.station_id").
+		Scan(&queues).Error
+	if err != nil {
+		return nil, err
+	}
+	prepTime := global.ORDER_CONFIG.PrepTimePerItem
+	var wait time.Duration
+	for _, queue := range queues {
+		ahead := queue.Total - own[queue.StationID]
+		tracking.QueueAhead += ahead
+		if stationWait := time.Duration(queue.Total) * prepTime; stationWait > wait {
+			wait = stationWait
+		}
+	}
+	tracking.EstimatedMinutes = int((wait + time.Minute - 1) / time.Minute)
+	return tracking, nil
+}
+
+// loadOrderTracking 重新读取订单并汇总进度
+func loadOrderTracking(orderID uint) (*OrderTracking, error) {
+	var order Order
+	if err := global.DB.Preload("Records").First(&order, orderID).Error; err != nil {
+		return nil, err
+	}
+	return BuildOrderTracking(&order)
+}
+
+// GetOrderStatus 顾客凭跟踪令牌查询订单进度和预计等待时间
+func GetOrderStatus(ctx *gin.Context) {
+	var order Order
+	if ok := GetOrderFromTrackingToken(ctx, &order, "Records"); !ok {
+		return
+	}
+	tracking, err := BuildOrderTracking(&order)
+	if err != nil {
+		log.Println()
+		log.Printf("Build order tracking error\n")
+		log.Printf("order: %d\n", order.ID)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询失败",
+		})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, tracking)
+}
+
+// affectsTracking 判断后厨事件是否可能改变订单进度，避免每个顾客的连接对每个事件都重新查询
+// 除本单外，只有同工位、排在前面的订单会影响排队份数，排队份数为 0 后不会再增加
+func affectsTracking(event *KitchenEvent, order *Order, last *OrderTracking) bool {
+	if event.OrderID == order.ID {
+		return true
+	}
+	if event.OrderID > order.ID || last == nil || last.QueueAhead == 0 {
+		return false
+	}
+	for _, item := range event.Items {
+		for _, record := range order.Records {
+			if item.StationID == record.StationID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OrderStatusSSE 以 Server-Sent Events 向顾客推送订单进度
+// 连接后先推送一次当前进度，之后本单有变动时重新计算，有变化时推送；订单结束后关闭连接
+func OrderStatusSSE(ctx *gin.Context) {
+	var order Order
+	if ok := GetOrderFromTrackingToken(ctx, &order, "Records"); !ok {
+		return
+	}
+	// 只关心之后的变动，当前进度在连接时直接推送
+	ch, _ := SubscribeKitchen(0)
+	defer UnsubscribeKitchen(ch)
+
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("X-Accel-Buffering", "no") // 关闭 nginx 缓冲
+	var last *OrderTracking
+	send := func() bool {
+		tracking, err := loadOrderTracking(order.ID)
+		if err != nil {
+			log.Printf("Build order tracking error, order: %d, error: %v\n", order.ID, err)
+			return false
+		}
+		if last == nil || !reflect.DeepEqual(last, tracking) {
+			ctx.Render(-1, sse.Event{
+				Event: "status",
+				Data:  tracking,
+			})
+			last = tracking
+		}
+		return !orderFinished(tracking.Status)
+	}
+
+	heartbeat := time.NewTicker(kitchenHeartbeat)
+	defer heartbeat.Stop()
+	first := true
+	ctx.Stream(func(w io.Writer) bool {
+		if first {
+			first = false
+			return send()
+		}
+		select {
+		case event, ok := <-ch:
+			// 处理不过来被断开时结束，浏览器会自动重连
+			if !ok {
+				return false
+			}
+			if !affectsTracking(&event, &order, last) {
+				return true
+			}
+			return send()
+		case <-heartbeat.C:
+			io.WriteString(w, ": ping\n\n")
+		case <-ctx.Request.Context().Done():
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,43 @@
+package controller
+
+import "testing"
+
+func TestAffectsTracking(t *testing.T) {
+	order := &Order{ID: 10, Records: []Record{{StationID: 1}, {StationID: 2}}}
+	queued := &OrderTracking{QueueAhead: 3}
+	event := func(orderID uint, stationIDs ...uint) *KitchenEvent {
+		items := make([]KitchenItem, 0, len(stationIDs))
+		for _, id := range stationIDs {
+			items = append(items, KitchenItem{StationID: id})
+		}
+		return &KitchenEvent{OrderID: orderID, Items: items}
+	}
+	tests := []struct {
+		name  string
+		event *KitchenEvent
+		last  *OrderTracking
+		want  bool
+	}{
+		{"本单", event(10), queued, true},
+		{"排在前面、同工位", event(8, 2), queued, true},
+		{"排在前面、其他工位", event(8, 3), queued, false},
+		{"排在后面", event(12, 1), queued, false},
+		{"前面已没有排队", event(8, 1), &OrderTracking{}, false},
+		{"还没有推送过", event(8, 1), nil, false},
+	}
+	for _, tt := range tests {
+		if got := affectsTracking(tt.event, order, tt.last); got != tt.want {
+			t.Errorf("%s: affectsTracking() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrderFinished(t *testing.T) {
+	for status := range orderStatusNames {
+		want := status == OrderStatusPaid || status == OrderStatusCancelled ||
+			status == OrderStatusVoided || status == OrderStatusRefunded
+		if got := orderFinished(status); got != want {
+			t.Errorf("orderFinished(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
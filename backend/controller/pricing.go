@@ -0,0 +1,396 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxBillCount 单行最多点的份数
+const maxBillCount = 99
+
+// BillError 账单校验失败，Msg 可以直接展示给顾客
+type BillError struct {
+	Line   int // 请求中的第几行，从 0 开始，-1 表示整个订单
+	DishID uint
+	Msg    string
+}
+
+func (e *BillError) Error() string {
+	return fmt.Sprintf("line %d, dish %d: %s", e.Line, e.DishID, e.Msg)
+}
+
+// BillErrors 账单中所有校验失败的行
+type BillErrors []*BillError
+
+func (errs BillErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// QuoteLine 报价中的一行
+type QuoteLine struct {
+	DishID    uint
+	Name      string
+	Options   []string
+	Count     int
+	UnitPrice Money // 含规格加价
+	Amount    Money
+	Discount  Money // 该行分摊到的优惠
+}
+
+// TaxLine 报价中的一项税
+type TaxLine struct {
+	Name      string
+	Rate      int64 // 基点
+	Inclusive bool  // 价内税只展示，不计入应付
+	Taxable   Money // 计税金额
+	Amount    Money
+}
+
+// Quote 分项报价，Total = Subtotal - Discount + 价外税 + ServiceCharge + Rounding
+type Quote struct {
+	Lines         []QuoteLine
+	Currency      string
+	Subtotal      Money
+	Promotions    []AppliedPromotion
+	Discount      Money
+	Taxes         []TaxLine
+	ServiceCharge Money
+	Rounding      Money
+	Total         Money
+
+	records    []Record // 可以直接作为订单明细保存
+	dishes     []*Dish  // 与 Lines 一一对应的菜品
+	categories *CategoryTree
+}
+
+// QuoteBills 校验账单并以数据库中的价格和当前生效的促销计算分项报价，防止篡改价格
+// 计算总价和提交订单都使用它，保证报价与实际收费一致；调用前先执行 ResetDailyStock
+//
+// 参数：
+//
+//	db *gorm.DB: 数据库连接，提交订单时传入事务
+//	bills []Bill: 点菜明细
+//	coupon string: 优惠码，可以为空
+//
+// 返回值：
+//
+//	*Quote: 分项报价
+//	error: 有行校验失败时为 BillErrors，包含所有失败的行；优惠码等整单错误为 *BillError
+func QuoteBills(db *gorm.DB, bills []Bill, coupon string) (*Quote, error) {
+	ids := make([]uint, 0, len(bills))
+	for _, bill := range bills {
+		ids = append(ids, bill.DishID)
+	}
+	var dishes []Dish
+	if err := db.Preload("OptionGroups.Options").Find(&dishes, ids).Error; err != nil {
+		return nil, err
+	}
+	if err := MarkIngredientShortages(db, dishes); err != nil {
+		return nil, err
+	}
+	dishMap := make(map[uint]*Dish, len(dishes))
+	for i := range dishes {
+		dishMap[dishes[i].ID] = &dishes[i]
+	}
+
+	quote := &Quote{
+		Lines:    make([]QuoteLine, 0, len(bills)),
+		Currency: global.PRICING_CONFIG.Currency,
+		records:  make([]Record, 0, len(bills)),
+	}
+	quote.dishes = make([]*Dish, 0, len(bills))
+	schedule, err := LoadMenuSchedule(db)
+	if err != nil {
+		return nil, err
+	}
+	quote.categories, err = LoadCategoryTree(db)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var errs BillErrors
+	for line, bill := range bills {
+		// 先校验所有行，一次返回全部错误
+		dish, options, err := checkBill(&bill, dishMap[bill.DishID])
+		if err != nil {
+			err.Line = line
+			errs = append(errs, err)
+			continue
+		}
+		if !quote.categories.Visible(dish.CategoryID) {
+			errs = append(errs, &BillError{Line: line, DishID: dish.ID, Msg: dish.Name + "暂不可点"})
+			continue
+		}
+		if !schedule.Available(dish, now) {
+			errs = append(errs, &BillError{Line: line, DishID: dish.ID, Msg: dish.Name + "不在供应时段"})
+			continue
+		}
+		price := dish.Price
+		names := make([]string, 0, len(options))
+		for _, option := range options {
+			price += option.PriceDelta
+			names = append(names, option.Name)
+		}
+		// 减价的规格可能使单价为负，说明菜品或规格的价格配置有误，不能下单
+		if price < 0 {
+			errs = append(errs, &BillError{Line: line, DishID: dish.ID, Msg: dish.Name + "所选规格的价格有误"})
+			continue
+		}
+		amount := price * Money(bill.Count)
+		quote.records = append(quote.records, Record{
+			DishID:  dish.ID,
+			Count:   bill.Count,
+			Price:   price,
+			Options: options,
+		})
+		quote.Lines = append(quote.Lines, QuoteLine{
+			DishID:    dish.ID,
+			Name:      dish.Name,
+			Options:   names,
+			Count:     bill.Count,
+			UnitPrice: price,
+			Amount:    amount,
+		})
+		quote.dishes = append(quote.dishes, dish)
+		quote.Subtotal += amount
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if errs := checkStock(bills, quote.dishes); len(errs) > 0 {
+		return nil, errs
+	}
+
+	promotions, err := loadPromotions(db, coupon, now)
+	if err != nil {
+		return nil, err
+	}
+	quote.Promotions = ApplyPromotions(quote.Lines, quote.dishes, promotions, quote.categories)
+	for i := range quote.Lines {
+		quote.records[i].Discount = quote.Lines[i].Discount
+		quote.Discount += quote.Lines[i].Discount
+	}
+
+	quote.applyCharges()
+	return quote, nil
+}
+
+// loadPromotions 加载 now 时生效的自动促销，以及优惠码对应的促销
+// 优惠码不存在、未生效或已用完时返回 *BillError
+func loadPromotions(db *gorm.DB, coupon string, now time.Time) ([]Promotion, error) {
+	var candidates []Promotion
+	if err := db.Where("active = ? AND (code = '' OR code = ?)", true, coupon).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	promotions := make([]Promotion, 0, len(candidates))
+	couponFound := false
+	for _, promotion := range candidates {
+		if !promotion.ActiveAt(now) {
+			continue
+		}
+		if promotion.Code != "" {
+			couponFound = true
+		}
+		promotions = append(promotions, promotion)
+	}
+	if coupon != "" && !couponFound {
+		return nil, &BillError{Line: -1, Msg: "优惠码无效或已过期"}
+	}
+	return promotions, nil
+}
+
+// applyCharges 在小计的基础上计算税、服务费和舍入，得到应付总额
+func (quote *Quote) applyCharges() {
+	conf := global.PRICING_CONFIG
+	quote.Taxes = make([]TaxLine, 0, len(conf.Taxes))
+	exclusiveTax := Money(0)
+	for _, tax := range conf.Taxes {
+		taxable := Money(0)
+		for i, line := range quote.Lines {
+			dish := quote.dishes[i]
+			if taxApplies(&tax, dish, quote.categories.Name(dish.CategoryID)) {
+				taxable += line.Net()
+			}
+		}
+		if taxable == 0 {
+			continue
+		}
+		taxLine := TaxLine{
+			Name:      tax.Name,
+			Rate:      tax.Rate,
+			Inclusive: tax.Inclusive,
+			Taxable:   taxable,
+		}
+		if tax.Inclusive {
+			// 含税价中的税额 = 含税价 - 含税价 / (1 + 税率)
+			taxLine.Amount = taxable - divRound(int64(taxable)*10000, 10000+tax.Rate)
+		} else {
+			taxLine.Amount = taxable.MulRate(tax.Rate)
+			exclusiveTax += taxLine.Amount
+		}
+		quote.Taxes = append(quote.Taxes, taxLine)
+	}
+
+	net := quote.Subtotal - quote.Discount
+	quote.ServiceCharge = net.MulRate(conf.ServiceCharge.Rate)
+	total := net + exclusiveTax + quote.ServiceCharge
+	quote.Total = total.RoundTo(conf.Rounding)
+	quote.Rounding = quote.Total - total
+}
+
+// TaxTotal 所有税额之和，含价内税
+func (quote *Quote) TaxTotal() Money {
+	total := Money(0)
+	for _, tax := range quote.Taxes {
+		total += tax.Amount
+	}
+	return total
+}
+
+// taxApplies 判断税率是否适用于该菜品，配置中的分类按名称匹配
+func taxApplies(tax *global.TaxRateConfig, dish *Dish, categoryName string) bool {
+	if len(tax.Categories) == 0 && len(tax.Dishes) == 0 {
+		return true
+	}
+	for _, category := range tax.Categories {
+		if category != "" && category == categoryName {
+			return true
+		}
+	}
+	for _, id := range tax.Dishes {
+		if id == dish.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBill 校验一行账单：数量、菜品是否存在且可售、规格是否合法
+//
+// 参数：
+//
+//	bill *Bill: 一行账单
+//	dish *Dish: 对应的菜品，不存在时为 nil
+//
+// 返回值：
+//
+//	*Dish: 对应的菜品
+//	[]RecordOption: 选择的规格
+//	*BillError: 校验失败时返回，Line 由调用方填写
+func checkBill(bill *Bill, dish *Dish) (*Dish, []RecordOption, *BillError) {
+	// 防止篡改数量
+	if bill.Count <= 0 {
+		return nil, nil, &BillError{DishID: bill.DishID, Msg: "数量必须大于0"}
+	}
+	if bill.Count > maxBillCount {
+		return nil, nil, &BillError{DishID: bill.DishID, Msg: fmt.Sprintf("单个菜品最多点%d份", maxBillCount)}
+	}
+	if dish == nil {
+		return nil, nil, &BillError{DishID: bill.DishID, Msg: "菜品不存在"}
+	}
+	if !dish.Available {
+		return nil, nil, &BillError{DishID: dish.ID, Msg: dish.Name + "暂不可点"}
+	}
+	if dish.SoldOut {
+		return nil, nil, &BillError{DishID: dish.ID, Msg: dish.Name + "已售罄"}
+	}
+	options, err := selectOptions(dish, bill.Options)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dish, options, nil
+}
+
+// selectOptions 校验选择的规格是否属于该菜品，并满足各规格组的单选/多选、必选和数量限制
+func selectOptions(dish *Dish, optionIDs []uint) ([]RecordOption, *BillError) {
+	selected := make(map[uint]bool, len(optionIDs))
+	for _, id := range optionIDs {
+		if selected[id] {
+			return nil, &BillError{DishID: dish.ID, Msg: "规格重复选择"}
+		}
+		selected[id] = true
+	}
+
+	options := make([]RecordOption, 0, len(optionIDs))
+	for _, group := range dish.OptionGroups {
+		count := 0
+		for _, option := range group.Options {
+			if selected[option.ID] {
+				count++
+				delete(selected, option.ID)
+				options = append(options, RecordOption{
+					OptionID:   option.ID,
+					Name:       group.Name + ":" + option.Name,
+					PriceDelta: option.PriceDelta,
+				})
+			}
+		}
+		min, max := group.SelectRange()
+		if count < min {
+			return nil, &BillError{DishID: dish.ID, Msg: fmt.Sprintf("%s「%s」至少选择%d项", dish.Name, group.Name, min)}
+		}
+		if max > 0 && count > max {
+			return nil, &BillError{DishID: dish.ID, Msg: fmt.Sprintf("%s「%s」最多选择%d项", dish.Name, group.Name, max)}
+		}
+	}
+	// 剩下的不属于该菜品
+	if len(selected) > 0 {
+		return nil, &BillError{DishID: dish.ID, Msg: dish.Name + "没有所选规格"}
+	}
+	return options, nil
+}
+
+// SelectRange 返回规格组实际生效的最少、最多选择数量，max 为 0 表示不限
+func (group *DishOptionGroup) SelectRange() (min int, max int) {
+	min, max = group.MinSelect, group.MaxSelect
+	if group.Required && min < 1 {
+		min = 1
+	}
+	if !group.Multiple {
+		max = 1
+	}
+	return min, max
+}
+
+// RespondQuoteError 把 QuoteBills 的错误写入响应，校验失败返回 400，其余返回 500
+// 行校验失败时 errors 中列出每一行的错误
+func RespondQuoteError(ctx *gin.Context, err error) {
+	var billErrs BillErrors
+	if errors.As(err, &billErrs) {
+		log.Printf("Invalid bills: %s\n", billErrs.Error())
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error":  billErrs[0].Msg,
+			"errors": billErrs,
+		})
+		return
+	}
+	var billErr *BillError
+	if errors.As(err, &billErr) {
+		log.Printf("Invalid bill: %s\n", billErr.Error())
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error":  billErr.Msg,
+			"errors": BillErrors{billErr},
+		})
+		return
+	}
+	log.Println()
+	log.Printf("Quote bills error\n")
+	log.Printf("error: %s\n", err.Error())
+	log.Println()
+	ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+		"error": "计算价格失败",
+	})
+}
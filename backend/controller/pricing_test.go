@@ -0,0 +1,95 @@
+package controller
+
+import "testing"
+
+func testOptionDish() *Dish {
+	return &Dish{
+		ID:    1,
+		Name:  "牛肉面",
+		Price: 2000,
+		OptionGroups: []DishOptionGroup{
+			{
+				Name:     "辣度",
+				Required: true,
+				Options: []DishOption{
+					{ID: 11, Name: "微辣"},
+					{ID: 12, Name: "特辣"},
+				},
+			},
+			{
+				Name:      "加料",
+				Multiple:  true,
+				MaxSelect: 2,
+				Options: []DishOption{
+					{ID: 21, Name: "加蛋", PriceDelta: 200},
+					{ID: 22, Name: "加肉", PriceDelta: 800},
+					{ID: 23, Name: "加面", PriceDelta: 300},
+				},
+			},
+		},
+	}
+}
+
+func TestSelectOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		optionIDs []uint
+		wantNames []string
+		wantDelta Money
+		wantErr   string
+	}{
+		{"必选一项", []uint{11}, []string{"辣度:微辣"}, 0, ""},
+		{"多选加价", []uint{12, 21, 22}, []string{"辣度:特辣", "加料:加蛋", "加料:加肉"}, 1000, ""},
+		{"缺少必选", []uint{21}, nil, 0, "牛肉面「辣度」至少选择1项"},
+		{"单选选了两项", []uint{11, 12}, nil, 0, "牛肉面「辣度」最多选择1项"},
+		{"超过最多数量", []uint{11, 21, 22, 23}, nil, 0, "牛肉面「加料」最多选择2项"},
+		{"重复选择", []uint{11, 11}, nil, 0, "规格重复选择"},
+		{"不属于该菜品", []uint{11, 99}, nil, 0, "牛肉面没有所选规格"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := selectOptions(testOptionDish(), tt.optionIDs)
+			if tt.wantErr != "" {
+				if err == nil || err.Msg != tt.wantErr {
+					t.Fatalf("selectOptions(%v) error = %v, want %q", tt.optionIDs, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectOptions(%v) error = %v", tt.optionIDs, err)
+			}
+			if len(options) != len(tt.wantNames) {
+				t.Fatalf("selectOptions(%v) returned %d options, want %d", tt.optionIDs, len(options), len(tt.wantNames))
+			}
+			delta := Money(0)
+			for i, option := range options {
+				if option.Name != tt.wantNames[i] {
+					t.Errorf("option %d name = %q, want %q", i, option.Name, tt.wantNames[i])
+				}
+				delta += option.PriceDelta
+			}
+			if delta != tt.wantDelta {
+				t.Errorf("price delta = %v, want %v", delta, tt.wantDelta)
+			}
+		})
+	}
+}
+
+func TestSelectRange(t *testing.T) {
+	tests := []struct {
+		group    DishOptionGroup
+		min, max int
+	}{
+		{DishOptionGroup{}, 0, 1},
+		{DishOptionGroup{Required: true}, 1, 1},
+		{DishOptionGroup{Multiple: true}, 0, 0},
+		{DishOptionGroup{Multiple: true, Required: true, MaxSelect: 3}, 1, 3},
+		{DishOptionGroup{Multiple: true, MinSelect: 2, MaxSelect: 4}, 2, 4},
+	}
+	for _, tt := range tests {
+		min, max := tt.group.SelectRange()
+		if min != tt.min || max != tt.max {
+			t.Errorf("SelectRange(%+v) = (%d, %d), want (%d, %d)", tt.group, min, max, tt.min, tt.max)
+		}
+	}
+}
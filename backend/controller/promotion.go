@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"sort"
+	"time"
+)
+
+// 促销规则类型
+const (
+	PromotionThreshold = "threshold" // 满减：适用菜品合计满 Threshold 减 Amount，如 满100减20
+	PromotionPercent   = "percent"   // 折扣：适用菜品减免 Percent，如 盖饭 九折
+	PromotionNthItem   = "nth_item"  // 第 N 件优惠：同一行每第 Nth 件减免 Percent，如 第二份半价
+)
+
+// AppliedPromotion 报价中生效的一项优惠
+type AppliedPromotion struct {
+	PromotionID uint
+	Name        string
+	Amount      Money
+}
+
+// IsPromotionType 判断是否为已定义的促销规则类型
+func IsPromotionType(promotionType string) bool {
+	switch promotionType {
+	case PromotionThreshold, PromotionPercent, PromotionNthItem:
+		return true
+	}
+	return false
+}
+
+// ActiveAt 判断促销在 now 时是否生效：已启用、在有效期和每日时段内、且未用完
+func (promotion *Promotion) ActiveAt(now time.Time) bool {
+	if !promotion.Active {
+		return false
+	}
+	if promotion.StartsAt != nil && now.Before(*promotion.StartsAt) {
+		return false
+	}
+	if promotion.EndsAt != nil && !now.Before(*promotion.EndsAt) {
+		return false
+	}
+	if promotion.UsageLimit > 0 && promotion.UsedCount >= promotion.UsageLimit {
+		return false
+	}
+	if promotion.DailyStart == "" || promotion.DailyEnd == "" {
+		return true
+	}
+	// 可以跨天，如 22:00 - 02:00
+	return inClock(now.Format("15:04"), promotion.DailyStart, promotion.DailyEnd)
+}
+
+// Matches 判断菜品是否在促销的适用范围内，指定分类时包括其子分类的菜品
+func (promotion *Promotion) Matches(dish *Dish, categories *CategoryTree) bool {
+	if promotion.DishID != 0 && promotion.DishID != dish.ID {
+		return false
+	}
+	if promotion.CategoryID != 0 && !categories.IsAncestor(promotion.CategoryID, dish.CategoryID) {
+		return false
+	}
+	return true
+}
+
+// ApplyPromotions 促销引擎：计算每一项生效的优惠，并把优惠金额分摊到每一行的 Discount 上
+// 先计算按行的折扣和第 N 件优惠，再在剩余金额上计算满减，每行优惠不会超过该行金额
+//
+// 参数：
+//
+//	lines []QuoteLine: 报价行，Discount 会被累加
+//	dishes []*Dish: 与 lines 一一对应的菜品
+//	promotions []Promotion: 候选促销，需已按 ActiveAt 过滤
+//	categories *CategoryTree: 所有分类，用于判断菜品是否属于促销指定的分类
+//
+// 返回值：
+//
+//	[]AppliedPromotion: 实际产生优惠的促销
+func ApplyPromotions(lines []QuoteLine, dishes []*Dish, promotions []Promotion, categories *CategoryTree) []AppliedPromotion {
+	// 满减最后计算，其余按 ID 顺序，保证结果稳定
+	sorted := make([]*Promotion, 0, len(promotions))
+	for i := range promotions {
+		sorted = append(sorted, &promotions[i])
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ti, tj := sorted[i].Type == PromotionThreshold, sorted[j].Type == PromotionThreshold
+		if ti != tj {
+			return tj
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	applied := make([]AppliedPromotion, 0, len(sorted))
+	for _, promotion := range sorted {
+		amount := Money(0)
+		switch promotion.Type {
+		case PromotionPercent:
+			for i := range lines {
+				if promotion.Matches(dishes[i], categories) {
+					amount += addDiscount(&lines[i], lines[i].Amount.MulRate(promotion.Percent))
+				}
+			}
+		case PromotionNthItem:
+			if promotion.Nth <= 0 {
+				continue
+			}
+			for i := range lines {
+				if promotion.Matches(dishes[i], categories) {
+					units := Money(lines[i].Count / promotion.Nth)
+					amount += addDiscount(&lines[i], lines[i].UnitPrice.MulRate(promotion.Percent)*units)
+				}
+			}
+		case PromotionThreshold:
+			amount = applyThreshold(lines, dishes, promotion, categories)
+		}
+		if amount > 0 {
+			applied = append(applied, AppliedPromotion{
+				PromotionID: promotion.ID,
+				Name:        promotion.Name,
+				Amount:      amount,
+			})
+		}
+	}
+	return applied
+}
+
+// applyThreshold 满减：适用行的剩余金额合计达到门槛时，按剩余金额比例分摊减免金额
+func applyThreshold(lines []QuoteLine, dishes []*Dish, promotion *Promotion, categories *CategoryTree) Money {
+	eligible := make([]int, 0, len(lines))
+	base := Money(0)
+	for i := range lines {
+		if promotion.Matches(dishes[i], categories) && lines[i].Net() > 0 {
+			eligible = append(eligible, i)
+			base += lines[i].Net()
+		}
+	}
+	if len(eligible) == 0 || base < promotion.Threshold {
+		return 0
+	}
+	discount := promotion.Amount
+	if discount > base {
+		discount = base
+	}
+	amount, remaining := Money(0), discount
+	for k, i := range eligible {
+		share := remaining
+		// 最后一行拿剩余部分，避免舍入误差
+		if k < len(eligible)-1 {
+			share = divRound(int64(discount)*int64(lines[i].Net()), int64(base))
+			remaining -= share
+		}
+		amount += addDiscount(&lines[i], share)
+	}
+	return amount
+}
+
+// addDiscount 给一行增加优惠，不超过该行剩余金额，返回实际增加的金额
+func addDiscount(line *QuoteLine, discount Money) Money {
+	if discount > line.Net() {
+		discount = line.Net()
+	}
+	if discount < 0 {
+		discount = 0
+	}
+	line.Discount += discount
+	return discount
+}
+
+// Net 该行优惠后的金额
+func (line *QuoteLine) Net() Money {
+	return line.Amount - line.Discount
+}
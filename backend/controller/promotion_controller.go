@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+)
+
+// checkPromotion 校验促销规则参数，优惠码不能与其他促销重复
+func checkPromotion(ctx *gin.Context, promotion *Promotion) bool {
+	msg := ""
+	switch {
+	case !IsPromotionType(promotion.Type):
+		msg = "未知的促销类型"
+	case promotion.Type == PromotionThreshold && (promotion.Amount <= 0 || promotion.Threshold < 0):
+		msg = "满减需要设置门槛和减免金额"
+	case promotion.Type != PromotionThreshold && (promotion.Percent <= 0 || promotion.Percent > 10000):
+		msg = "优惠比例需在 1 到 10000 基点之间"
+	case promotion.Type == PromotionNthItem && promotion.Nth < 2:
+		msg = "第N件优惠的N至少为2"
+	case promotion.StartsAt != nil && promotion.EndsAt != nil && !promotion.StartsAt.Before(*promotion.EndsAt):
+		msg = "开始时间需早于结束时间"
+	case promotion.UsageLimit < 0:
+		msg = "使用次数上限不能为负"
+	}
+	for _, clock := range []string{promotion.DailyStart, promotion.DailyEnd} {
+		if _, err := time.Parse("15:04", clock); clock != "" && err != nil {
+			msg = "每日时段格式应为 HH:MM"
+		}
+	}
+	if msg == "" && promotion.Code != "" {
+		var count int64
+		if err := global.DB.Model(&Promotion{}).
+			Where("code = ? AND id <> ?", promotion.Code, promotion.ID).
+			Count(&count).Error; err != nil {
+			log.Printf("Check promotion code error: %v\n", err)
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+				"error": "查询错误",
+			})
+			return false
+		}
+		if count > 0 {
+			msg = "优惠码已存在"
+		}
+	}
+	if msg != "" {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": msg,
+		})
+		return false
+	}
+	if ok := checkDishCategory(ctx, promotion.CategoryID); !ok {
+		return false
+	}
+	return true
+}
+
+// GetAllPromotions 获取所有促销
+func GetAllPromotions(ctx *gin.Context) {
+	var promotions []Promotion
+	if ok := GetAllDatas(ctx, &promotions, nil); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, promotions)
+}
+
+// AddPromotion 添加促销，未提供 Active 时默认启用
+func AddPromotion(ctx *gin.Context) {
+	promotion := Promotion{Active: true}
+	if ok := BindJSON(ctx, &promotion); !ok {
+		return
+	}
+	promotion.ID = 0
+	promotion.UsedCount = 0
+	if ok := checkPromotion(ctx, &promotion); !ok {
+		return
+	}
+	if ok := CreateDataWithoutBind(ctx, &promotion); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, promotion)
+}
+
+// UpdatePromotion 更新促销，已使用次数不会被修改
+func UpdatePromotion(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var promotion Promotion
+	if ok := GetData(ctx, &promotion, map[string]interface{}{"id": id}); !ok {
+		return
+	}
+	promotionID, usedCount := promotion.ID, promotion.UsedCount
+	if ok := BindJSON(ctx, &promotion); !ok {
+		return
+	}
+	promotion.ID, promotion.UsedCount = promotionID, usedCount
+	if ok := checkPromotion(ctx, &promotion); !ok {
+		return
+	}
+	if err := global.DB.Select("*").Omit("id", "used_count").Updates(&promotion).Error; err != nil {
+		log.Println()
+		log.Printf("Update promotion error\n")
+		log.Printf("promotion: %+v\n", promotion)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "更新失败",
+		})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, promotion)
+}
+
+// DeletePromotion 删除促销，已下单的优惠记录保留
+func DeletePromotion(ctx *gin.Context) {
+	id := ctx.Param("id")
+	iid, _ := strconv.Atoi(id)
+	promotion := Promotion{ID: uint(iid)}
+	if ok := DeleteData(ctx, &promotion); !ok {
+		return
+	}
+	log.Println()
+	log.Printf("Delete promotion: %s\n", id)
+	ctx.IndentedJSON(http.StatusNoContent, nil)
+}
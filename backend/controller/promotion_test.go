@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func testCategories() *CategoryTree {
+	parent := uint(10)
+	return newCategoryTree([]Category{
+		{ID: 1, Name: "面食", Visible: true},
+		{ID: 2, Name: "饮品", Visible: true},
+		{ID: 10, Name: "盖饭", Visible: true},
+		{ID: 11, Name: "牛肉盖饭", Visible: true, ParentID: &parent},
+	})
+}
+
+func testQuoteLines() ([]QuoteLine, []*Dish) {
+	dishes := []*Dish{
+		{ID: 1, Name: "牛肉面", CategoryID: 1},
+		{ID: 2, Name: "奶茶", CategoryID: 2},
+	}
+	lines := []QuoteLine{
+		{DishID: 1, Count: 2, UnitPrice: 1000, Amount: 2000},
+		{DishID: 2, Count: 1, UnitPrice: 3000, Amount: 3000},
+	}
+	return lines, dishes
+}
+
+func TestApplyPromotions(t *testing.T) {
+	tests := []struct {
+		name          string
+		promotions    []Promotion
+		wantApplied   []Money // 按生效顺序
+		wantDiscounts []Money // 每行分摊到的优惠
+	}{
+		{
+			name: "折扣、第二份半价后再满减",
+			promotions: []Promotion{
+				{ID: 3, Type: PromotionThreshold, Threshold: 4000, Amount: 500},
+				{ID: 1, Type: PromotionPercent, CategoryID: 1, Percent: 1000},
+				{ID: 2, Type: PromotionNthItem, DishID: 1, Nth: 2, Percent: 5000},
+			},
+			// 满减在剩余的 1300 和 3000 上按比例分摊，最后一行拿剩余部分
+			wantApplied:   []Money{200, 500, 500},
+			wantDiscounts: []Money{200 + 500 + 151, 349},
+		},
+		{
+			name: "未达到门槛",
+			promotions: []Promotion{
+				{ID: 1, Type: PromotionThreshold, Threshold: 6000, Amount: 500},
+			},
+			wantApplied:   []Money{},
+			wantDiscounts: []Money{0, 0},
+		},
+		{
+			name: "减免金额不超过适用菜品的金额",
+			promotions: []Promotion{
+				{ID: 1, Type: PromotionThreshold, DishID: 1, Threshold: 1000, Amount: 5000},
+			},
+			wantApplied:   []Money{2000},
+			wantDiscounts: []Money{2000, 0},
+		},
+		{
+			name: "不满第 N 件不优惠",
+			promotions: []Promotion{
+				{ID: 1, Type: PromotionNthItem, DishID: 2, Nth: 2, Percent: 5000},
+			},
+			wantApplied:   []Money{},
+			wantDiscounts: []Money{0, 0},
+		},
+		{
+			name: "多个折扣叠加不超过行金额",
+			promotions: []Promotion{
+				{ID: 1, Type: PromotionPercent, CategoryID: 2, Percent: 8000},
+				{ID: 2, Type: PromotionPercent, DishID: 2, Percent: 5000},
+			},
+			wantApplied:   []Money{2400, 600},
+			wantDiscounts: []Money{0, 3000},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, dishes := testQuoteLines()
+			applied := ApplyPromotions(lines, dishes, tt.promotions, testCategories())
+			if len(applied) != len(tt.wantApplied) {
+				t.Fatalf("applied %+v, want amounts %v", applied, tt.wantApplied)
+			}
+			for i, want := range tt.wantApplied {
+				if applied[i].Amount != want {
+					t.Errorf("applied[%d] = %+v, want amount %d", i, applied[i], want)
+				}
+			}
+			for i, want := range tt.wantDiscounts {
+				if lines[i].Discount != want {
+					t.Errorf("line %d discount = %d, want %d", i, lines[i].Discount, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPromotionMatches(t *testing.T) {
+	categories := testCategories()
+	dish := &Dish{ID: 5, CategoryID: 11}
+	tests := []struct {
+		name      string
+		promotion Promotion
+		want      bool
+	}{
+		{"不限范围", Promotion{}, true},
+		{"指定菜品", Promotion{DishID: 5}, true},
+		{"其他菜品", Promotion{DishID: 6}, false},
+		{"所属分类", Promotion{CategoryID: 11}, true},
+		{"上级分类", Promotion{CategoryID: 10}, true},
+		{"其他分类", Promotion{CategoryID: 1}, false},
+		{"分类和菜品都要满足", Promotion{CategoryID: 10, DishID: 6}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.promotion.Matches(dish, categories); got != tt.want {
+			t.Errorf("%s: Matches() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPromotionActiveAt(t *testing.T) {
+	at := func(clock string) time.Time {
+		parsed, _ := time.Parse("2006-01-02 15:04", "2026-10-18 "+clock)
+		return parsed
+	}
+	start, end := at("00:00"), at("00:00").AddDate(0, 0, 7)
+	tests := []struct {
+		name      string
+		promotion Promotion
+		now       time.Time
+		want      bool
+	}{
+		{"启用且不限时段", Promotion{Active: true}, at("12:00"), true},
+		{"停用", Promotion{}, at("12:00"), false},
+		{"开始之前", Promotion{Active: true, StartsAt: &start}, start.Add(-time.Minute), false},
+		{"开始时刻", Promotion{Active: true, StartsAt: &start}, start, true},
+		{"结束时刻", Promotion{Active: true, EndsAt: &end}, end, false},
+		{"已用完", Promotion{Active: true, UsageLimit: 10, UsedCount: 10}, at("12:00"), false},
+		{"未用完", Promotion{Active: true, UsageLimit: 10, UsedCount: 9}, at("12:00"), true},
+		{"下午茶时段内", Promotion{Active: true, DailyStart: "14:00", DailyEnd: "17:00"}, at("16:59"), true},
+		{"下午茶结束", Promotion{Active: true, DailyStart: "14:00", DailyEnd: "17:00"}, at("17:00"), false},
+		{"跨天时段凌晨", Promotion{Active: true, DailyStart: "22:00", DailyEnd: "02:00"}, at("01:30"), true},
+		{"跨天时段白天", Promotion{Active: true, DailyStart: "22:00", DailyEnd: "02:00"}, at("12:00"), false},
+	}
+	for _, tt := range tests {
+		if got := tt.promotion.ActiveAt(tt.now); got != tt.want {
+			t.Errorf("%s: ActiveAt(%s) = %v, want %v", tt.name, tt.now.Format(time.RFC3339), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"log"
+	"net/http"
+	"sort"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+)
+
+// 用户角色
+const (
+	RoleOwner    = "owner"    // 老板
+	RoleManager  = "manager"  // 店长
+	RoleCashier  = "cashier"  // 收银
+	RoleWaiter   = "waiter"   // 服务员
+	RoleKitchen  = "kitchen"  // 后厨
+	RoleCustomer = "customer" // 顾客，注册用户的默认角色
+)
+
+// 权限
+const (
+	PermMenuWrite       = "menu:write"       // 增删改菜品
+	PermMenuStock       = "menu:stock"       // 估清、设置每日份数
+	PermInventoryWrite  = "inventory:write"  // 管理原料、配方，出入库
+	PermPromotionsWrite = "promotions:write" // 管理促销和优惠码
+	PermOrdersRead      = "orders:read"      // 查看订单
+	PermOrdersUpdate    = "orders:update"    // 推进订单状态：接单、制作、上菜
+	PermOrdersVoid      = "orders:void"      // 取消、作废订单
+	PermPaymentsTake    = "payments:take"    // 收款，订单标记为已支付
+	PermTablesWrite     = "tables:write"     // 管理桌子和二维码
+	PermUsersWrite      = "users:write"      // 查看用户、分配角色
+	PermReportsRead     = "reports:read"     // 查看报表
+)
+
+// rolePermissions 每个角色拥有的权限
+var rolePermissions = map[string][]string{
+	RoleOwner: {
+		PermMenuWrite, PermMenuStock, PermInventoryWrite, PermPromotionsWrite, PermOrdersRead, PermOrdersUpdate, PermOrdersVoid,
+		PermPaymentsTake, PermTablesWrite, PermUsersWrite, PermReportsRead,
+	},
+	RoleManager: {
+		PermMenuWrite, PermMenuStock, PermInventoryWrite, PermPromotionsWrite, PermOrdersRead, PermOrdersUpdate, PermOrdersVoid,
+		PermPaymentsTake, PermTablesWrite, PermUsersWrite, PermReportsRead,
+	},
+	RoleCashier:  {PermOrdersRead, PermPaymentsTake},
+	RoleWaiter:   {PermMenuStock, PermOrdersRead, PermOrdersUpdate},
+	RoleKitchen:  {PermMenuStock, PermInventoryWrite, PermOrdersRead, PermOrdersUpdate},
+	RoleCustomer: {},
+}
+
+// transitionPermissions 变更到某个订单状态额外需要的权限，未列出的状态需要 orders:update
+var transitionPermissions = map[string]string{
+	OrderStatusPaid:      PermPaymentsTake,
+	OrderStatusCancelled: PermOrdersVoid,
+	OrderStatusVoided:    PermOrdersVoid,
+	OrderStatusRefunded:  PermOrdersVoid,
+}
+
+// IsRole 判断 role 是否为已定义的角色
+func IsRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission 判断用户的角色是否拥有权限 perm
+func HasPermission(user *User, perm string) bool {
+	for _, p := range rolePermissions[user.Role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission 要求当前用户拥有权限 perm，需放在 AuthRequired 之后
+//
+// 参数：
+//
+//	perm string: 访问该接口需要的权限
+//
+// 返回值：
+//
+//	gin.HandlerFunc: 中间件，没有权限返回 403
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user := CurrentUser(ctx)
+		if user == nil || !HasPermission(user, perm) {
+			log.Printf("Permission %s denied, path: %s\n", perm, ctx.Request.URL.Path)
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":      "没有权限",
+				"permission": perm,
+			})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// GetRoles 列出所有角色及其权限
+func GetRoles(ctx *gin.Context) {
+	roles := make([]string, 0, len(rolePermissions))
+	for role := range rolePermissions {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	result := make([]gin.H, 0, len(roles))
+	for _, role := range roles {
+		result = append(result, gin.H{
+			"role":        role,
+			"permissions": rolePermissions[role],
+		})
+	}
+	ctx.IndentedJSON(http.StatusOK, result)
+}
+
+// GetAllUsers 获取所有用户
+func GetAllUsers(ctx *gin.Context) {
+	var users []User
+	if ok := GetAllDatas(ctx, &users, nil); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, users)
+}
+
+// AssignRole 给用户分配角色，只有老板可以任命或撤销老板
+func AssignRole(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var input struct {
+		Role string `binding:"required"`
+	}
+	if ok := BindJSON(ctx, &input); !ok {
+		return
+	}
+	if !IsRole(input.Role) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": "未知的角色",
+		})
+		return
+	}
+	var user User
+	if ok := GetData(ctx, &user, map[string]interface{}{"id": id}); !ok {
+		return
+	}
+	operator := CurrentUser(ctx)
+	if (input.Role == RoleOwner || user.Role == RoleOwner) && operator.Role != RoleOwner {
+		ctx.IndentedJSON(http.StatusForbidden, gin.H{
+			"error": "只有老板可以任命或撤销老板",
+		})
+		return
+	}
+	if err := global.DB.Model(&user).Update("role", input.Role).Error; err != nil {
+		log.Println()
+		log.Printf("Assign role error\n")
+		log.Printf("user: %d, role: %s\n", user.ID, input.Role)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "分配角色失败",
+		})
+		return
+	}
+	log.Printf("User %s assigned role %s to user %d\n", operator.Username, input.Role, user.ID)
+	ctx.IndentedJSON(http.StatusOK, user)
+}
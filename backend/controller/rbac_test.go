@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withUser 跳过认证，直接把 user 作为当前用户
+func withUser(user *User) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if user != nil {
+			ctx.Set(ctxUserKey, user)
+		}
+		ctx.Next()
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	allPerms := []string{
+		PermMenuWrite, PermMenuStock, PermInventoryWrite, PermPromotionsWrite, PermOrdersRead, PermOrdersUpdate,
+		PermOrdersVoid, PermPaymentsTake, PermTablesWrite, PermUsersWrite, PermReportsRead,
+	}
+	tests := []struct {
+		role  string
+		perms []string
+	}{
+		{RoleOwner, allPerms},
+		{RoleManager, allPerms},
+		{RoleCashier, []string{PermOrdersRead, PermPaymentsTake}},
+		{RoleWaiter, []string{PermMenuStock, PermOrdersRead, PermOrdersUpdate}},
+		{RoleKitchen, []string{PermMenuStock, PermInventoryWrite, PermOrdersRead, PermOrdersUpdate}},
+		{RoleCustomer, nil},
+		{"admin", nil}, // 迁移前的旧角色没有任何权限
+	}
+	for _, tt := range tests {
+		for _, perm := range allPerms {
+			r := gin.New()
+			r.GET("/", withUser(&User{ID: 1, Role: tt.role}), RequirePermission(perm), func(ctx *gin.Context) {
+				ctx.Status(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			want := http.StatusForbidden
+			if slices.Contains(tt.perms, perm) {
+				want = http.StatusOK
+			}
+			if w.Code != want {
+				t.Errorf("role %s, RequirePermission(%s) status = %d, want %d", tt.role, perm, w.Code, want)
+			}
+		}
+	}
+
+	// 没有经过认证
+	r := gin.New()
+	r.GET("/", RequirePermission(PermOrdersRead), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("without user, status = %d, want 403", w.Code)
+	}
+}
+
+func TestTransitionOrderPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// 每个角色可以变更到的状态
+	allowed := map[string][]string{
+		RoleOwner:    {OrderStatusAccepted, OrderStatusCooking, OrderStatusServed, OrderStatusPaid, OrderStatusCancelled, OrderStatusVoided, OrderStatusRefunded},
+		RoleManager:  {OrderStatusAccepted, OrderStatusCooking, OrderStatusServed, OrderStatusPaid, OrderStatusCancelled, OrderStatusVoided, OrderStatusRefunded},
+		RoleCashier:  {OrderStatusPaid},
+		RoleWaiter:   {OrderStatusAccepted, OrderStatusCooking, OrderStatusServed},
+		RoleKitchen:  {OrderStatusAccepted, OrderStatusCooking, OrderStatusServed},
+		RoleCustomer: nil,
+	}
+	statuses := []string{
+		OrderStatusAccepted, OrderStatusCooking, OrderStatusServed, OrderStatusPaid,
+		OrderStatusCancelled, OrderStatusVoided, OrderStatusRefunded,
+	}
+	for role, targets := range allowed {
+		for _, status := range statuses {
+			// 有权限时继续查询订单，订单不存在返回 404
+			useFakeDB(t)
+			r := gin.New()
+			r.POST("/orders/:id/transition", withUser(&User{ID: 1, Role: role}), TransitionOrder)
+			w := httptest.NewRecorder()
+			body := strings.NewReader(`{"Status": "` + status + `"}`)
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders/1/transition", body))
+			want := http.StatusForbidden
+			if slices.Contains(targets, status) {
+				want = http.StatusNotFound
+			}
+			if w.Code != want {
+				t.Errorf("role %s, transition to %s status = %d, want %d", role, status, w.Code, want)
+			}
+		}
+	}
+}
+
+func TestAssignRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name     string
+		operator string
+		current  string // 被分配用户当前的角色
+		role     string
+		want     int
+	}{
+		{"老板任命老板", RoleOwner, RoleManager, RoleOwner, http.StatusOK},
+		{"老板撤销老板", RoleOwner, RoleOwner, RoleManager, http.StatusOK},
+		{"老板分配其他角色", RoleOwner, RoleCustomer, RoleWaiter, http.StatusOK},
+		{"店长分配其他角色", RoleManager, RoleCustomer, RoleCashier, http.StatusOK},
+		{"店长任命店长", RoleManager, RoleWaiter, RoleManager, http.StatusOK},
+		{"店长不能任命老板", RoleManager, RoleManager, RoleOwner, http.StatusForbidden},
+		{"店长不能撤销老板", RoleManager, RoleOwner, RoleCustomer, http.StatusForbidden},
+		{"店长不能修改老板", RoleManager, RoleOwner, RoleOwner, http.StatusForbidden},
+		{"未知的角色", RoleOwner, RoleCustomer, "admin", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		db := useFakeDB(t, userRows(User{ID: 2, Username: "staff", Role: tt.current}))
+		r := gin.New()
+		r.PUT("/users/:id/role", withUser(&User{ID: 1, Username: "operator", Role: tt.operator}), AssignRole)
+		w := httptest.NewRecorder()
+		body := strings.NewReader(`{"Role": "` + tt.role + `"}`)
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/users/2/role", body))
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d, body %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+		updates := db.Executed("UPDATE `users` SET `role`=?")
+		if tt.want == http.StatusOK {
+			if len(updates) != 1 || updates[0].Args[0] != tt.role {
+				t.Errorf("%s: updates = %+v, want role set to %s", tt.name, updates, tt.role)
+			}
+		} else if len(updates) != 0 {
+			t.Errorf("%s: updates = %+v, want none", tt.name, updates)
+		}
+	}
+}
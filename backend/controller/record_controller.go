@@ -1,12 +1,9 @@
 package controller
 
 import (
-	"log"
 	"net/http"
-	"sync"
-	"time"
+	"strconv"
 
-	"example.com/m/v2/global"
 	"github.com/gin-gonic/gin"
 )
 
@@ -25,8 +22,7 @@ func GetAllRecords(ctx *gin.Context) {
 	ctx.IndentedJSON(http.StatusOK, records)
 }
 
-// SubmitOrder 处理订单提交请求，将订单中的账单信息转换为记录存入数据库，
-// 并在订单提交成功后异步删除过期记录。
+// GetRecentRecords 获取近期记录
 //
 // 参数:
 // ctx: *gin.Context - gin 框架的上下文对象，用于处理 HTTP 请求和响应。
@@ -40,52 +36,63 @@ func GetRecentRecords(ctx *gin.Context) {
 	}
 }
 
+// SubmitOrder 处理订单提交请求，在一个事务中创建订单及其明细记录。
+// 携带 Idempotency-Key 请求头时，重复提交直接返回第一次的结果，不会重复下单。
+//
+// 参数:
+// ctx: *gin.Context - gin 框架的上下文对象，需携带扫码得到的桌号令牌，查询参数 coupon 为优惠码，guests 为就餐人数。
+//
+// 返回值:
+// 无返回值
 func SubmitOrder(ctx *gin.Context) {
+	var table Table
+	if ok := GetTableFromToken(ctx, &table); !ok {
+		return
+	}
 	var bills []Bill
 	if ok := BindJSON(ctx, &bills); !ok {
 		return
 	}
-	for _, bill := range bills {
-		cnt := bill.Count
-		// 防止篡改数量
-		if cnt <= 0 {
-			log.Printf("Count must be positive, dish_id: %d, count: %d\n", bill.DishID, cnt)
-			ctx.IndentedJSON(http.StatusBadRequest, gin.H{
-				"error": "Count must be positive",
-			})
-			return
-		}
-		record := Record{
-			DishID: bill.DishID,
-			Time:   time.Now().Format("2006-01-02 15:04:05"),
-			Count:  bill.Count,
+	if len(bills) == 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": "订单为空",
+		})
+		return
+	}
+	coupon := ctx.Query("coupon")
+	guests, err := strconv.Atoi(ctx.DefaultQuery("guests", "0"))
+	if err != nil || guests < 0 {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": "就餐人数无效",
+		})
+		return
+	}
+	key, ok := ClaimIdempotencyKey(ctx, table.ID, HashSubmitRequest(table.ID, bills, coupon, guests))
+	if !ok {
+		return
+	}
+	order := Order{
+		TableID: table.ID,
+		TableNo: table.Number,
+		Status:  OrderStatusPlaced,
+		Guests:  guests,
+	}
+	if ok := CreateOrder(ctx, &order, bills, coupon, key); !ok {
+		if key != nil {
+			ReleaseIdempotencyKey(key)
 		}
-		CreateDataWithoutBind(ctx, &record)
+		return
 	}
-	ctx.IndentedJSON(http.StatusOK, gin.H{
-		"msg": "提交成功",
-	})
-
-	// 清空过期记录
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		DeleteExpiredRecords(ctx)
-	}()
-	wg.Wait()
+	ctx.IndentedJSON(http.StatusOK, SubmitOrderResponse(&order))
+	PublishOrderEvent(KitchenEventOrderCreated, order.ID)
 }
 
-func DeleteExpiredRecords(ctx *gin.Context) {
-	// 超过一个月的记录
-	expiredTime := time.Now().AddDate(0, -1, 0).Format("2006-01-02 15:04:05")
-	var records []Record
-	if err := global.DB.Where("time < ?", expiredTime).Delete(&records).Error; err != nil {
-		log.Println()
-		log.Printf("Delete expired records error")
-		log.Printf("expired_time: %s\n", expiredTime)
-		log.Printf("%v\n", err.Error())
-		log.Println()
-		return
+// SubmitOrderResponse 下单成功的响应，幂等重放时返回同样的内容
+func SubmitOrderResponse(order *Order) gin.H {
+	return gin.H{
+		"msg":            "提交成功",
+		"order_id":       order.ID,
+		"tracking_token": OrderTrackingToken(order),
+		"total":          order.Total,
 	}
 }
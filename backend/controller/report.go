@@ -0,0 +1,448 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"example.com/m/v2/global"
+)
+
+// 销售报表的分组方式
+const (
+	ReportByDay      = "day"
+	ReportByHour     = "hour"
+	ReportByWeekday  = "weekday"
+	ReportByDish     = "dish"
+	ReportByCategory = "category"
+	ReportByArea     = "area"
+)
+
+// 单个报表最多统计的营业日数
+const reportMaxDays = 366
+
+var weekdayNames = []string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}
+
+// SalesQuery 销售报表的查询条件，From、To 为营业日（含）
+type SalesQuery struct {
+	From        string
+	To          string
+	GroupBy     string
+	IncludeOpen bool // 是否包含未结账的订单，默认只统计已支付的订单
+}
+
+// SalesRow 报表中的一行
+//
+// 备注：
+//
+//	按日期、小时、星期分组时 Revenue 为订单实收（含税和服务费），AverageTicket 为单均实收；
+//	按菜品、分类分组时 Revenue 为菜品分摊优惠后的销售额（不含税和服务费），Orders 为包含该菜品的订单数，
+//	Covers 没有意义，为 0；按区域分组时与按日期分组相同
+type SalesRow struct {
+	Key           string
+	Label         string
+	Revenue       Money
+	NetSales      Money // 折后销售额，不含税和服务费
+	Orders        int
+	Covers        int // 就餐人数，未填写人数的订单按 1 人计
+	AverageTicket Money
+	Items         int // 菜品份数
+}
+
+// SalesReport 销售报表，Summary 为整个时间范围的合计
+type SalesReport struct {
+	From    string
+	To      string
+	GroupBy string
+	Summary SalesRow
+	Rows    []SalesRow
+}
+
+// ParseSalesQuery 校验报表的查询条件，from、to 为空时默认最近 7 个营业日
+func ParseSalesQuery(from string, to string, groupBy string, includeOpen bool) (SalesQuery, error) {
+	query := SalesQuery{GroupBy: groupBy, IncludeOpen: includeOpen}
+	if query.GroupBy == "" {
+		query.GroupBy = ReportByDay
+	}
+	switch query.GroupBy {
+	case ReportByDay, ReportByHour, ReportByWeekday, ReportByDish, ReportByCategory, ReportByArea:
+	default:
+		return query, fmt.Errorf("group_by 只能为 day、hour、weekday、dish、category、area")
+	}
+	var err error
+	query.From, query.To, err = ParseDateRange(from, to)
+	return query, err
+}
+
+// ParseDateRange 校验营业日范围（含），为空时默认截至今天的最近 7 个营业日
+func ParseDateRange(from string, to string) (string, string, error) {
+	if to == "" {
+		to = BusinessDay(time.Now())
+	}
+	end, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return from, to, fmt.Errorf("日期格式应为 2006-01-02")
+	}
+	if from == "" {
+		from = end.AddDate(0, 0, -6).Format("2006-01-02")
+	}
+	start, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return from, to, fmt.Errorf("日期格式应为 2006-01-02")
+	}
+	if start.After(end) {
+		return from, to, fmt.Errorf("开始日期不能晚于结束日期")
+	}
+	if end.Sub(start) >= reportMaxDays*24*time.Hour {
+		return from, to, fmt.Errorf("时间范围不能超过 %d 天", reportMaxDays)
+	}
+	return from, to, nil
+}
+
+// BusinessDayRange 返回营业日范围（含）对应的时间区间 [start, end)
+func BusinessDayRange(from string, to string) (time.Time, time.Time) {
+	clock, _ := time.Parse("15:04", global.MENU_CONFIG.BusinessDayStart)
+	offset := time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute
+	start, _ := time.ParseInLocation("2006-01-02", from, global.MENU_CONFIG.Location)
+	end, _ := time.ParseInLocation("2006-01-02", to, global.MENU_CONFIG.Location)
+	return start.Add(offset), end.AddDate(0, 0, 1).Add(offset)
+}
+
+func (query SalesQuery) timeRange() (time.Time, time.Time) {
+	return BusinessDayRange(query.From, query.To)
+}
+
+func (query SalesQuery) statuses() []string {
+	if query.IncludeOpen {
+		return []string{OrderStatusPlaced, OrderStatusAccepted, OrderStatusCooking, OrderStatusServed, OrderStatusPaid}
+	}
+	return []string{OrderStatusPaid}
+}
+
+// salesBucket 按小时汇总的订单数据
+type salesBucket struct {
+	Bucket      string
+	SalesRollup `gorm:"embedded"`
+}
+
+// loadSalesBuckets 在数据库中按下单时间的整点汇总订单和菜品份数
+//
+// 备注：
+//
+//	数据库中的时间为服务器本地时间，整点汇总后在 Go 中换算成营业日、营业时区的小时和星期
+func loadSalesBuckets(query SalesQuery) ([]salesBucket, error) {
+	start, end := query.timeRange()
+	const bucket = "DATE_FORMAT(orders.created_at, '%Y-%m-%d %H:00:00')"
+	var buckets []salesBucket
+	err := global.DB.Table("orders").
+		Select(bucket+" AS bucket, SUM(orders.total) AS revenue, SUM(orders.subtotal - orders.discount) AS net_sales, "+
+			"COUNT(*) AS orders, SUM(GREATEST(orders.guests, 1)) AS covers").
+		Where("orders.status IN ?", query.statuses()).
+		Where("orders.created_at >= ? AND orders.created_at < ?", start, end).
+		Group("bucket").
+		Scan(&buckets).Error
+	if err != nil {
+		return nil, err
+	}
+	var items []struct {
+		Bucket string
+		Items  int
+	}
+	err = global.DB.Table("records").
+		Select(bucket+" AS bucket, SUM(records.count) AS items").
+		Joins("JOIN orders ON orders.id = records.order_id").
+		Where("orders.status IN ?", query.statuses()).
+		Where("orders.created_at >= ? AND orders.created_at < ?", start, end).
+		Group("bucket").
+		Scan(&items).Error
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int, len(buckets))
+	for i := range buckets {
+		index[buckets[i].Bucket] = i
+	}
+	for _, item := range items {
+		if i, ok := index[item.Bucket]; ok {
+			buckets[i].Items = item.Items
+		}
+	}
+	return buckets, nil
+}
+
+// loadLineSales 按 column（records.dish_id 或 dishes.category_id）汇总订单明细，金额取下单时的价格快照，
+// 分类取菜品当前所属的分类
+func loadLineSales(query SalesQuery, column string) ([]SalesRollup, error) {
+	start, end := query.timeRange()
+	var rows []SalesRollup
+	err := global.DB.Table("records").
+		Select("COALESCE("+column+", 0) AS dimension_key, SUM(records.price * records.count - records.discount) AS revenue, "+
+			"SUM(records.price * records.count - records.discount) AS net_sales, "+
+			"COUNT(DISTINCT records.order_id) AS orders, SUM(records.count) AS items").
+		Joins("JOIN orders ON orders.id = records.order_id").
+		Joins("LEFT JOIN dishes ON dishes.id = records.dish_id").
+		Where("orders.status IN ?", query.statuses()).
+		Where("orders.created_at >= ? AND orders.created_at < ?", start, end).
+		Group("dimension_key").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// loadAreaSales 按桌子当前的区域汇总订单
+func loadAreaSales(query SalesQuery) ([]SalesRollup, error) {
+	start, end := query.timeRange()
+	var rows []SalesRollup
+	err := global.DB.Table("orders").
+		Select("COALESCE(tables.area, '') AS dimension_key, SUM(orders.total) AS revenue, "+
+			"SUM(orders.subtotal - orders.discount) AS net_sales, COUNT(*) AS orders, SUM(GREATEST(orders.guests, 1)) AS covers, "+
+			"SUM((SELECT COALESCE(SUM(records.count), 0) FROM records WHERE records.order_id = orders.id)) AS items").
+		Joins("LEFT JOIN tables ON tables.id = orders.table_id").
+		Where("orders.status IN ?", query.statuses()).
+		Where("orders.created_at >= ? AND orders.created_at < ?", start, end).
+		Group("dimension_key").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// BuildSalesReport 生成销售报表
+//
+// 备注：
+//
+//	只统计已支付订单、且范围内的订单都已计入汇总表时从汇总表读取，否则按原始订单统计；
+//	原始订单按保留策略清理后，历史数据只能从汇总表查到
+func BuildSalesReport(query SalesQuery) (*SalesReport, error) {
+	if !query.IncludeOpen {
+		ready, err := rollupsReady(query.timeRange())
+		if err != nil {
+			return nil, err
+		}
+		if ready {
+			return buildSalesReportFromRollups(query)
+		}
+	}
+	buckets, err := loadSalesBuckets(query)
+	if err != nil {
+		return nil, err
+	}
+	report := newSalesReport(query)
+	for _, bucket := range buckets {
+		report.Summary.add(bucket.SalesRollup)
+	}
+	report.Summary.finish()
+
+	switch query.GroupBy {
+	case ReportByDish, ReportByCategory, ReportByArea:
+		var sales []SalesRollup
+		switch query.GroupBy {
+		case ReportByDish:
+			sales, err = loadLineSales(query, "records.dish_id")
+		case ReportByCategory:
+			sales, err = loadLineSales(query, "dishes.category_id")
+		default:
+			sales, err = loadAreaSales(query)
+		}
+		if err == nil {
+			report.Rows, err = labelSalesRows(query.GroupBy, sales)
+		}
+		if err != nil {
+			return nil, err
+		}
+	default:
+		rows := map[string]*SalesRow{}
+		for _, bucket := range buckets {
+			t, _ := time.ParseInLocation("2006-01-02 15:04:05", bucket.Bucket, time.Local)
+			key, label := groupKey(query.GroupBy, BusinessDay(t), t.In(global.MENU_CONFIG.Location).Hour())
+			salesRow(rows, key, label).add(bucket.SalesRollup)
+		}
+		report.Rows = sortedRows(rows)
+	}
+	return report, nil
+}
+
+// rollupDimensions 报表分组对应的汇总维度
+var rollupDimensions = map[string]string{
+	ReportByDish:     RollupDish,
+	ReportByCategory: RollupCategory,
+	ReportByArea:     RollupArea,
+}
+
+// buildSalesReportFromRollups 从汇总表生成销售报表，按小时分组时读小时汇总表，其余读日汇总表
+func buildSalesReportFromRollups(query SalesQuery) (*SalesReport, error) {
+	var totals []DailySalesRollup
+	err := global.DB.Where("dimension = ? AND day BETWEEN ? AND ?", RollupTotal, query.From, query.To).
+		Find(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+	report := newSalesReport(query)
+	for _, total := range totals {
+		report.Summary.add(total.SalesRollup)
+	}
+	report.Summary.finish()
+
+	switch query.GroupBy {
+	case ReportByDish, ReportByCategory, ReportByArea:
+		var sales []SalesRollup
+		err := global.DB.Model(&DailySalesRollup{}).
+			Select("dimension_key, SUM(revenue) AS revenue, SUM(net_sales) AS net_sales, "+
+				"SUM(orders) AS orders, SUM(covers) AS covers, SUM(items) AS items").
+			Where("dimension = ? AND day BETWEEN ? AND ?", rollupDimensions[query.GroupBy], query.From, query.To).
+			Group("dimension_key").
+			Scan(&sales).Error
+		if err == nil {
+			report.Rows, err = labelSalesRows(query.GroupBy, sales)
+		}
+		if err != nil {
+			return nil, err
+		}
+	case ReportByHour:
+		var hourly []HourlySalesRollup
+		err := global.DB.Where("dimension = ? AND day BETWEEN ? AND ?", RollupTotal, query.From, query.To).
+			Find(&hourly).Error
+		if err != nil {
+			return nil, err
+		}
+		rows := map[string]*SalesRow{}
+		for _, hour := range hourly {
+			key, label := groupKey(query.GroupBy, hour.Day, hour.Hour)
+			salesRow(rows, key, label).add(hour.SalesRollup)
+		}
+		report.Rows = sortedRows(rows)
+	default:
+		rows := map[string]*SalesRow{}
+		for _, total := range totals {
+			key, label := groupKey(query.GroupBy, total.Day, 0)
+			salesRow(rows, key, label).add(total.SalesRollup)
+		}
+		report.Rows = sortedRows(rows)
+	}
+	return report, nil
+}
+
+func newSalesReport(query SalesQuery) *SalesReport {
+	return &SalesReport{
+		From:    query.From,
+		To:      query.To,
+		GroupBy: query.GroupBy,
+		Summary: SalesRow{Key: "total", Label: "合计"},
+		Rows:    []SalesRow{},
+	}
+}
+
+// groupKey 返回按日期、小时、星期分组时的键和显示名称，星期按营业日算，凌晨的订单算前一天
+func groupKey(groupBy string, day string, hour int) (string, string) {
+	switch groupBy {
+	case ReportByHour:
+		key := fmt.Sprintf("%02d", hour)
+		return key, key + ":00"
+	case ReportByWeekday:
+		date, _ := time.Parse("2006-01-02", day)
+		weekday := int(date.Weekday())
+		return strconv.Itoa(weekday), weekdayNames[weekday]
+	default:
+		return day, day
+	}
+}
+
+func salesRow(rows map[string]*SalesRow, key string, label string) *SalesRow {
+	row, ok := rows[key]
+	if !ok {
+		row = &SalesRow{Key: key, Label: label}
+		rows[key] = row
+	}
+	return row
+}
+
+// sortedRows 计算单均并按键排序，全部退款后为空的行不显示
+func sortedRows(rows map[string]*SalesRow) []SalesRow {
+	result := make([]SalesRow, 0, len(rows))
+	for _, row := range rows {
+		if row.Orders == 0 && row.Revenue == 0 {
+			continue
+		}
+		row.finish()
+		result = append(result, *row)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// labelSalesRows 按菜品、分类或区域分组时补上显示名称，销售额高的在前；已删除的菜品和分类也保留销售额
+func labelSalesRows(groupBy string, sales []SalesRollup) ([]SalesRow, error) {
+	labels := map[string]string{}
+	switch groupBy {
+	case ReportByDish:
+		ids := make([]string, len(sales))
+		for i := range sales {
+			ids[i] = sales[i].DimensionKey
+		}
+		var dishes []Dish
+		if len(ids) > 0 {
+			if err := global.DB.Select("id", "name").Where("id IN ?", ids).Find(&dishes).Error; err != nil {
+				return nil, err
+			}
+		}
+		for _, dish := range dishes {
+			labels[strconv.FormatUint(uint64(dish.ID), 10)] = dish.Name
+		}
+	case ReportByCategory:
+		categories, err := LoadCategoryTree(global.DB)
+		if err != nil {
+			return nil, err
+		}
+		for _, sale := range sales {
+			id, _ := strconv.ParseUint(sale.DimensionKey, 10, 64)
+			labels[sale.DimensionKey] = categories.Name(uint(id))
+		}
+	default:
+		for _, sale := range sales {
+			labels[sale.DimensionKey] = sale.DimensionKey
+		}
+	}
+
+	rows := make([]SalesRow, 0, len(sales))
+	for _, sale := range sales {
+		if sale.Orders == 0 && sale.Revenue == 0 {
+			continue
+		}
+		label := labels[sale.DimensionKey]
+		switch {
+		case label != "":
+		case groupBy == ReportByDish:
+			label = "已删除菜品 #" + sale.DimensionKey
+		case groupBy == ReportByCategory:
+			label = "未分类"
+		default:
+			label = "未分区"
+		}
+		row := SalesRow{Key: sale.DimensionKey, Label: label}
+		row.add(sale)
+		row.finish()
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Revenue != rows[j].Revenue {
+			return rows[i].Revenue > rows[j].Revenue
+		}
+		return rows[i].Key < rows[j].Key
+	})
+	return rows, nil
+}
+
+func (row *SalesRow) add(sales SalesRollup) {
+	row.Revenue += sales.Revenue
+	row.NetSales += sales.NetSales
+	row.Orders += sales.Orders
+	row.Covers += sales.Covers
+	row.Items += sales.Items
+}
+
+// finish 计算单均
+func (row *SalesRow) finish() {
+	if row.Orders > 0 {
+		row.AverageTicket = divRound(int64(row.Revenue), int64(row.Orders))
+	}
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSalesReport 销售报表：按营业日、小时、星期、菜品或分类汇总实收、就餐人数、单均和菜品份数
+//
+// 参数：
+//
+//	ctx *gin.Context: Gin 框架的上下文对象，查询参数：
+//	from/to 营业日范围（含，默认最近 7 天）、group_by 分组方式、include_open=true 包含未结账的订单
+//
+// 返回值：
+//
+//	无返回值，返回 SalesReport，金额取下单时的价格快照
+func GetSalesReport(ctx *gin.Context) {
+	report, ok := buildSalesReport(ctx)
+	if !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, report)
+}
+
+// buildSalesReport 按查询参数生成销售报表，失败时已写入错误响应
+func buildSalesReport(ctx *gin.Context) (*SalesReport, bool) {
+	query, err := ParseSalesQuery(ctx.Query("from"), ctx.Query("to"), ctx.Query("group_by"), ctx.Query("include_open") == "true")
+	if err != nil {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return nil, false
+	}
+	report, err := BuildSalesReport(query)
+	if err != nil {
+		log.Println()
+		log.Printf("Build sales report error\n")
+		log.Printf("query: %+v\n", query)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "生成报表失败",
+		})
+		return nil, false
+	}
+	return report, true
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateRange(t *testing.T) {
+	setMenuConfig(t, "Asia/Shanghai", "04:00")
+	tests := []struct {
+		name     string
+		from, to string
+		wantFrom string
+		wantTo   string
+		wantErr  bool
+	}{
+		{"指定范围", "2026-10-01", "2026-10-07", "2026-10-01", "2026-10-07", false},
+		{"同一天", "2026-10-01", "2026-10-01", "2026-10-01", "2026-10-01", false},
+		{"默认最近 7 天", "", "2026-10-07", "2026-10-01", "2026-10-07", false},
+		{"最长 366 天", "2025-10-08", "2026-10-08", "2025-10-08", "2026-10-08", false},
+		{"超过 366 天", "2025-10-07", "2026-10-08", "", "", true},
+		{"开始晚于结束", "2026-10-08", "2026-10-07", "", "", true},
+		{"开始日期格式错误", "2026/10/01", "2026-10-07", "", "", true},
+		{"结束日期格式错误", "2026-10-01", "10-07", "", "", true},
+	}
+	for _, tt := range tests {
+		from, to, err := ParseDateRange(tt.from, tt.to)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: ParseDateRange(%q, %q) = %s, %s, want error", tt.name, tt.from, tt.to, from, to)
+			}
+			continue
+		}
+		if err != nil || from != tt.wantFrom || to != tt.wantTo {
+			t.Errorf("%s: ParseDateRange(%q, %q) = %s, %s, %v; want %s, %s", tt.name, tt.from, tt.to, from, to, err, tt.wantFrom, tt.wantTo)
+		}
+	}
+
+	// 都为空时截至今天
+	from, to, err := ParseDateRange("", "")
+	if err != nil || to != BusinessDay(time.Now()) {
+		t.Fatalf("ParseDateRange(\"\", \"\") = %s, %s, %v; want to = today", from, to, err)
+	}
+	end, _ := time.Parse("2006-01-02", to)
+	if want := end.AddDate(0, 0, -6).Format("2006-01-02"); from != want {
+		t.Errorf("ParseDateRange(\"\", \"\") from = %s, want %s", from, want)
+	}
+}
+
+func TestBusinessDayRange(t *testing.T) {
+	shanghai := setMenuConfig(t, "Asia/Shanghai", "04:00")
+	start, end := BusinessDayRange("2026-10-01", "2026-10-07")
+	if want := time.Date(2026, 10, 1, 4, 0, 0, 0, shanghai); !start.Equal(want) {
+		t.Errorf("start = %s, want %s", start, want)
+	}
+	if want := time.Date(2026, 10, 8, 4, 0, 0, 0, shanghai); !end.Equal(want) {
+		t.Errorf("end = %s, want %s", end, want)
+	}
+	// 区间两端与 BusinessDay 一致
+	if day := BusinessDay(start); day != "2026-10-01" {
+		t.Errorf("BusinessDay(start) = %s, want 2026-10-01", day)
+	}
+	if day := BusinessDay(end.Add(-time.Second)); day != "2026-10-07" {
+		t.Errorf("BusinessDay(end - 1s) = %s, want 2026-10-07", day)
+	}
+}
+
+func TestParseSalesQuery(t *testing.T) {
+	setMenuConfig(t, "Asia/Shanghai", "04:00")
+	query, err := ParseSalesQuery("2026-10-01", "2026-10-07", "", false)
+	if err != nil || query.GroupBy != ReportByDay {
+		t.Errorf("ParseSalesQuery() = %+v, %v; want group by day", query, err)
+	}
+	if got := query.statuses(); len(got) != 1 || got[0] != OrderStatusPaid {
+		t.Errorf("statuses() = %v, want only paid orders", got)
+	}
+	query, _ = ParseSalesQuery("2026-10-01", "2026-10-07", ReportByArea, true)
+	for _, status := range query.statuses() {
+		if orderFinished(status) && status != OrderStatusPaid {
+			t.Errorf("statuses() with include_open contains %s", status)
+		}
+	}
+	if _, err := ParseSalesQuery("2026-10-01", "2026-10-07", "month", false); err == nil {
+		t.Error("ParseSalesQuery() with group_by=month, want error")
+	}
+}
@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"example.com/m/v2/global"
+	"gorm.io/gorm"
+)
+
+// 归档方式
+const (
+	ArchiveFile = "file"
+	ArchiveNone = "none"
+)
+
+// 已结束、可以清理的订单状态，未结账的订单无论多久都保留
+var finishedOrderStatuses = []string{OrderStatusPaid, OrderStatusCancelled, OrderStatusVoided, OrderStatusRefunded}
+
+// retentionTask 清理一种数据：archive 为 nil 时不归档，返回删除的行数
+type retentionTask func(cutoff time.Time, archive *archiveFile, batchSize int) (int, error)
+
+// RetentionTasks 支持配置保留策略的数据类型
+var RetentionTasks = map[string]retentionTask{
+	"orders":           purgeOrders,
+	"stock_movements":  purgeByColumn[StockMovement]("created_at"),
+	"idempotency_keys": purgeByColumn[IdempotencyKey]("expires_at"),
+	"refresh_tokens":   purgeByColumn[RefreshToken]("expires_at"),
+}
+
+// archiveFile 归档文件，每行一条 JSON，gzip 压缩；第一次写入时才创建
+type archiveFile struct {
+	path string
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+}
+
+func newArchiveFile(entity string, now time.Time) *archiveFile {
+	name := fmt.Sprintf("%s-%s.jsonl.gz", entity, now.Format("20060102-150405"))
+	return &archiveFile{path: filepath.Join(global.RETENTION_CONFIG.ArchiveDir, entity, name)}
+}
+
+func (a *archiveFile) Write(row interface{}) error {
+	if a.file == nil {
+		if err := os.MkdirAll(filepath.Dir(a.path), 0o755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		a.file, a.gz = file, gzip.NewWriter(file)
+		a.enc = json.NewEncoder(a.gz)
+	}
+	return a.enc.Encode(row)
+}
+
+// Sync 把已写入的数据落盘，之后才能删除对应的行
+func (a *archiveFile) Sync() error {
+	if a.file == nil {
+		return nil
+	}
+	if err := a.gz.Flush(); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+func (a *archiveFile) Close() error {
+	if a.file == nil {
+		return nil
+	}
+	if err := a.gz.Close(); err != nil {
+		a.file.Close()
+		return err
+	}
+	return a.file.Close()
+}
+
+// archiveRows 归档一批数据并落盘，archive 为 nil 时什么都不做
+func archiveRows[T any](archive *archiveFile, rows []T) error {
+	if archive == nil {
+		return nil
+	}
+	for i := range rows {
+		if err := archive.Write(&rows[i]); err != nil {
+			return err
+		}
+	}
+	return archive.Sync()
+}
+
+// purgeOrders 分批归档并删除已结束的旧订单，明细、规格、状态变更和优惠记录一起删除
+// 已支付和退款的订单要等计入销售汇总表后才删除，报表仍能查到
+func purgeOrders(cutoff time.Time, archive *archiveFile, batchSize int) (int, error) {
+	total := 0
+	for {
+		var orders []Order
+		err := global.DB.Preload("Records.Options").Preload("Transitions").Preload("Promotions").
+			Where("created_at < ? AND status IN ?", cutoff, finishedOrderStatuses).
+			Where("(status NOT IN ? OR rolled_up = status)", []string{OrderStatusPaid, OrderStatusRefunded}).
+			Order("id").Limit(batchSize).Find(&orders).Error
+		if err != nil || len(orders) == 0 {
+			return total, err
+		}
+		if err := archiveRows(archive, orders); err != nil {
+			return total, err
+		}
+		orderIDs := make([]uint, 0, len(orders))
+		var recordIDs []uint
+		for _, order := range orders {
+			orderIDs = append(orderIDs, order.ID)
+			for _, record := range order.Records {
+				recordIDs = append(recordIDs, record.ID)
+			}
+		}
+		err = global.DB.Transaction(func(tx *gorm.DB) error {
+			if len(recordIDs) > 0 {
+				if err := tx.Where("record_id IN ?", recordIDs).Delete(&RecordOption{}).Error; err != nil {
+					return err
+				}
+			}
+			for _, model := range []interface{}{&Record{}, &OrderTransition{}, &OrderPromotion{}} {
+				if err := tx.Where("order_id IN ?", orderIDs).Delete(model).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Delete(&Order{}, orderIDs).Error
+		})
+		if err != nil {
+			return total, err
+		}
+		total += len(orders)
+	}
+}
+
+// purgeByColumn 返回按时间列分批归档并删除单表数据的任务
+func purgeByColumn[T any](column string) retentionTask {
+	return func(cutoff time.Time, archive *archiveFile, batchSize int) (int, error) {
+		total := 0
+		for {
+			var rows []T
+			err := global.DB.Where(column+" < ?", cutoff).Order("id").Limit(batchSize).Find(&rows).Error
+			if err != nil || len(rows) == 0 {
+				return total, err
+			}
+			if err := archiveRows(archive, rows); err != nil {
+				return total, err
+			}
+			if err := global.DB.Delete(&rows).Error; err != nil {
+				return total, err
+			}
+			total += len(rows)
+		}
+	}
+}
+
+var retentionMu sync.Mutex
+
+// RunRetention 按配置的保留策略清理各类数据，先归档再删除
+//
+// 备注：
+//
+//	删除失败时已归档的数据会在下次执行时再归档一次，恢复时按 ID 去重
+func RunRetention() {
+	retentionMu.Lock()
+	defer retentionMu.Unlock()
+	conf := global.RETENTION_CONFIG
+	now := time.Now()
+	for entity, policy := range conf.Policies {
+		if policy.Keep == "" {
+			continue
+		}
+		keep, _ := ParseWindow(policy.Keep)
+		var archive *archiveFile
+		if policy.Archive == ArchiveFile {
+			archive = newArchiveFile(entity, now)
+		}
+		count, err := RetentionTasks[entity](now.Add(-keep), archive, conf.BatchSize)
+		if archive != nil {
+			if closeErr := archive.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			log.Println()
+			log.Printf("Retention error\n")
+			log.Printf("entity: %s, purged: %d\n", entity, count)
+			log.Printf("%v\n", err.Error())
+			log.Println()
+			continue
+		}
+		if count > 0 {
+			log.Printf("Retention: purged %d %s older than %s\n", count, entity, policy.Keep)
+		}
+	}
+}
+
+// StartRetention 在后台定时执行清理，启动后先执行一次，不占用请求
+func StartRetention() {
+	go func() {
+		for {
+			RunRetention()
+			time.Sleep(global.RETENTION_CONFIG.Interval)
+		}
+	}()
+}
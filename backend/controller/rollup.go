@@ -0,0 +1,269 @@
+package controller
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"example.com/m/v2/global"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 汇总的维度
+const (
+	RollupTotal    = "total"
+	RollupDish     = "dish"
+	RollupCategory = "category"
+	RollupArea     = "area"
+)
+
+const (
+	rollupPollInterval = time.Minute // 没有通知时也定期检查，补上遗漏的订单
+	rollupBatchSize    = 100
+)
+
+var (
+	rollupMu   sync.Mutex
+	rollupWake = make(chan struct{}, 1)
+)
+
+// rollupUpsert 汇总行已存在时累加
+var rollupUpsert = clause.OnConflict{DoUpdates: clause.Assignments(map[string]interface{}{
+	"revenue":   gorm.Expr("revenue + VALUES(revenue)"),
+	"net_sales": gorm.Expr("net_sales + VALUES(net_sales)"),
+	"orders":    gorm.Expr("orders + VALUES(orders)"),
+	"covers":    gorm.Expr("covers + VALUES(covers)"),
+	"items":     gorm.Expr("items + VALUES(items)"),
+})}
+
+// rollupPending 需要计入或冲销的订单：已支付未计入，或已退款未冲销
+func rollupPending(db *gorm.DB) *gorm.DB {
+	return db.Where("((orders.status = ? AND orders.rolled_up = ?) OR (orders.status = ? AND orders.rolled_up <> ?))",
+		OrderStatusPaid, "", OrderStatusRefunded, OrderStatusRefunded)
+}
+
+// NotifyRollup 通知后台尽快处理新支付或退款的订单，不会阻塞
+func NotifyRollup() {
+	select {
+	case rollupWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartRollupWorker 在后台增量维护销售汇总表，订单支付时计入、退款时冲销
+//
+// 备注：
+//
+//	订单上的 RolledUp 记录已计入的状态，和汇总表在同一事务中更新，重复处理不会重复计入；
+//	启动时没有计入的历史订单也会被逐步补上
+func StartRollupWorker() {
+	go func() {
+		ticker := time.NewTicker(rollupPollInterval)
+		defer ticker.Stop()
+		for {
+			if err := processPendingRollups(); err != nil {
+				log.Printf("Process rollups error: %v\n", err)
+			}
+			select {
+			case <-rollupWake:
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func processPendingRollups() error {
+	rollupMu.Lock()
+	defer rollupMu.Unlock()
+	lastID := uint(0)
+	for {
+		var ids []uint
+		err := rollupPending(global.DB.Model(&Order{})).
+			Where("orders.id > ?", lastID).Order("orders.id").Limit(rollupBatchSize).
+			Pluck("orders.id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		for _, id := range ids {
+			if err := global.DB.Transaction(func(tx *gorm.DB) error {
+				return rollupOrder(tx, id)
+			}); err != nil {
+				return fmt.Errorf("order %d: %w", id, err)
+			}
+		}
+		lastID = ids[len(ids)-1]
+	}
+}
+
+// rollupOrder 锁定订单，按当前状态计入或冲销，并记录已处理的状态
+func rollupOrder(tx *gorm.DB, orderID uint) error {
+	var order Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Records").First(&order, orderID).Error; err != nil {
+		return err
+	}
+	switch {
+	case order.Status == OrderStatusPaid && order.RolledUp == "":
+		if err := addRollups(tx, &order, 1); err != nil {
+			return err
+		}
+	case order.Status == OrderStatusRefunded && order.RolledUp == OrderStatusPaid:
+		if err := addRollups(tx, &order, -1); err != nil {
+			return err
+		}
+	case order.Status == OrderStatusRefunded && order.RolledUp == "":
+		// 支付后还没计入就退款了，不需要冲销
+	default:
+		return nil
+	}
+	return tx.Model(&order).Update("rolled_up", order.Status).Error
+}
+
+// addRollups 把订单按各维度累加到小时和日汇总表，sign 为 -1 时冲销
+//
+// 备注：
+//
+//	分类取菜品当前所属的分类，区域取桌子当前的区域
+func addRollups(tx *gorm.DB, order *Order, sign int) error {
+	dishIDs := make([]uint, 0, len(order.Records))
+	for _, record := range order.Records {
+		dishIDs = append(dishIDs, record.DishID)
+	}
+	var dishes []Dish
+	if len(dishIDs) > 0 {
+		if err := tx.Select("id", "category_id").Where("id IN ?", dishIDs).Find(&dishes).Error; err != nil {
+			return err
+		}
+	}
+	categoryOf := make(map[uint]uint, len(dishes))
+	for _, dish := range dishes {
+		categoryOf[dish.ID] = dish.CategoryID
+	}
+	var table Table
+	if err := tx.Select("id", "area").Limit(1).Find(&table, order.TableID).Error; err != nil {
+		return err
+	}
+
+	items := 0
+	byDish := map[string]*SalesRollup{}
+	byCategory := map[string]*SalesRollup{}
+	for _, record := range order.Records {
+		items += record.Count
+		amount := record.Price*Money(record.Count) - record.Discount
+		for _, row := range []*SalesRollup{
+			lineRollup(byDish, RollupDish, strconv.FormatUint(uint64(record.DishID), 10)),
+			lineRollup(byCategory, RollupCategory, strconv.FormatUint(uint64(categoryOf[record.DishID]), 10)),
+		} {
+			row.Revenue += amount
+			row.NetSales += amount
+			row.Items += record.Count
+		}
+	}
+	total := SalesRollup{
+		Dimension: RollupTotal,
+		Revenue:   order.Total,
+		NetSales:  order.Subtotal - order.Discount,
+		Orders:    1,
+		Covers:    max(order.Guests, 1),
+		Items:     items,
+	}
+	area := total
+	area.Dimension, area.DimensionKey = RollupArea, table.Area
+	rows := []SalesRollup{total, area}
+	for _, group := range []map[string]*SalesRollup{byDish, byCategory} {
+		for _, row := range group {
+			rows = append(rows, *row)
+		}
+	}
+
+	local := order.CreatedAt.In(global.MENU_CONFIG.Location)
+	day := BusinessDay(order.CreatedAt)
+	hourly := make([]HourlySalesRollup, len(rows))
+	daily := make([]DailySalesRollup, len(rows))
+	for i, row := range rows {
+		row.Revenue *= Money(sign)
+		row.NetSales *= Money(sign)
+		row.Orders *= sign
+		row.Covers *= sign
+		row.Items *= sign
+		hourly[i] = HourlySalesRollup{Day: day, Hour: local.Hour(), Start: hourStart(local), SalesRollup: row}
+		daily[i] = DailySalesRollup{Day: day, SalesRollup: row}
+	}
+	if err := tx.Clauses(rollupUpsert).Create(&hourly).Error; err != nil {
+		return err
+	}
+	return tx.Clauses(rollupUpsert).Create(&daily).Error
+}
+
+// hourStart 返回 t 所在的当地整点；Truncate 按绝对时间截断，在 +05:30 等非整点时区会和 Hour() 错开
+func hourStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+}
+
+// lineRollup 返回订单内某个菜品或分类的汇总行，一个订单对每个菜品或分类只计一单
+func lineRollup(rows map[string]*SalesRollup, dimension string, key string) *SalesRollup {
+	row, ok := rows[key]
+	if !ok {
+		row = &SalesRollup{Dimension: dimension, DimensionKey: key, Orders: 1}
+		rows[key] = row
+	}
+	return row
+}
+
+// RebuildRollups 按原始订单重建营业日范围（含）内的汇总表
+//
+// 备注：
+//
+//	原始订单按保留策略清理后就无法重建，范围早于订单保留期限时返回错误
+func RebuildRollups(from string, to string) (int, error) {
+	start, end := BusinessDayRange(from, to)
+	if policy := global.RETENTION_CONFIG.Policies["orders"]; policy.Keep != "" {
+		keep, _ := ParseWindow(policy.Keep)
+		if start.Before(time.Now().Add(-keep)) {
+			return 0, fmt.Errorf("orders before %s have been purged by retention (keep %s)",
+				BusinessDay(time.Now().Add(-keep)), policy.Keep)
+		}
+	}
+	rollupMu.Lock()
+	defer rollupMu.Unlock()
+	count := 0
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&HourlySalesRollup{}, &DailySalesRollup{}} {
+			if err := tx.Where("day BETWEEN ? AND ?", from, to).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		// 锁住范围内的订单，重建期间状态不会变化
+		var orders []Order
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Records").
+			Where("created_at >= ? AND created_at < ?", start, end).
+			Where("status IN ?", []string{OrderStatusPaid, OrderStatusRefunded}).
+			FindInBatches(&orders, rollupBatchSize, func(batch *gorm.DB, _ int) error {
+				for i := range orders {
+					if orders[i].Status == OrderStatusPaid {
+						if err := addRollups(tx, &orders[i], 1); err != nil {
+							return err
+						}
+					}
+					if err := tx.Model(&orders[i]).Update("rolled_up", orders[i].Status).Error; err != nil {
+						return err
+					}
+				}
+				count += len(orders)
+				return nil
+			}).Error
+		return err
+	})
+	return count, err
+}
+
+// rollupsReady 判断时间区间内已支付和退款的订单是否都已计入汇总表
+func rollupsReady(start time.Time, end time.Time) (bool, error) {
+	var pending int64
+	err := rollupPending(global.DB.Model(&Order{})).
+		Where("orders.created_at >= ? AND orders.created_at < ?", start, end).
+		Count(&pending).Error
+	return pending == 0, err
+}
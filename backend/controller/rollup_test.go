@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHourStart(t *testing.T) {
+	tests := []struct {
+		timezone string
+		offset   time.Duration // 整点相对于 UTC 的偏移
+	}{
+		{"UTC", 0},
+		{"Asia/Shanghai", 8 * time.Hour},
+		{"Asia/Kolkata", 5*time.Hour + 30*time.Minute},
+		{"Asia/Kathmandu", 5*time.Hour + 45*time.Minute},
+		{"Australia/Darwin", 9*time.Hour + 30*time.Minute},
+		{"America/St_Johns", -(2*time.Hour + 30*time.Minute)}, // 10 月为夏令时 -02:30
+	}
+	for _, tt := range tests {
+		location, err := time.LoadLocation(tt.timezone)
+		if err != nil {
+			t.Fatalf("load location %q: %v", tt.timezone, err)
+		}
+		local := time.Date(2026, 10, 1, 12, 47, 13, 500, location)
+		got := hourStart(local)
+		if want := time.Date(2026, 10, 1, 12, 0, 0, 0, location); !got.Equal(want) {
+			t.Errorf("%s: hourStart(%s) = %s, want %s", tt.timezone, local, got, want)
+		}
+		if got.Hour() != local.Hour() || got.Minute() != 0 {
+			t.Errorf("%s: hourStart(%s) = %s, not the start of local hour %d", tt.timezone, local, got, local.Hour())
+		}
+		if _, offset := got.Zone(); time.Duration(offset)*time.Second != tt.offset {
+			t.Errorf("%s: offset = %ds, want %s", tt.timezone, offset, tt.offset)
+		}
+	}
+}
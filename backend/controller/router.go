@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"time"
 
+	"example.com/m/v2/global"
+	"example.com/m/v2/storage"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
@@ -89,8 +91,8 @@ func SetMiddlewares(r *gin.Engine) {
 		// AllowOrigins: []string{"http://127.0.0.1:5173"},
 		AllowOriginFunc:  MyAllowOriginFunc,
 		AllowMethods:     []string{"GET", "POST", "OPTIONS", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", TableTokenHeader, OrderTokenHeader, IdempotencyKeyHeader, "Last-Event-ID"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Disposition", "Idempotent-Replayed"},
 		AllowCredentials: true,
 		// AllowOriginFunc: func(origin string) bool {
 		// 	return origin == "https://github.com"
@@ -119,14 +121,28 @@ func SetupRouter() *gin.Engine {
 	// middleware需要在router注册之前
 	SetMiddlewares(r)
 
+	// 本地存储时由后端直接提供上传的图片，文件名不会复用，允许长期缓存
+	if local, ok := global.STORAGE.(*storage.Local); ok {
+		uploads := r.Group(local.BaseURL, func(c *gin.Context) {
+			c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		})
+		uploads.Static("/", local.Dir)
+	}
+
 	api := r.Group("/api")
 	{
 		api.GET("/get_dish/:id", GetDish)
 		api.GET("/get_dishes", GetAllDishes)
 		api.GET("/get_dishes_by_category/:category", GetDishesByCategory)
+		api.GET("/dishes/search", SearchDishes)
+		api.GET("/categories", GetCategories)
 		api.GET("/get_hot_dishes", GetHotDishes)
 		api.POST("/get_total_price", GetTotalPrice)
 		api.POST("/submit_order", SubmitOrder)
+		api.GET("/orders/:id", GetOrder)
+		api.GET("/orders/:id/status", GetOrderStatus)
+		api.GET("/orders/:id/status/stream", OrderStatusSSE)
+		api.GET("/table", GetCurrentTable)
 	}
 	// r.GET("/api/get_total_price", GetTotalPrice)
 	// api.USE(middleware)
@@ -135,13 +151,81 @@ func SetupRouter() *gin.Engine {
 	{
 		user.POST("/user_login", UserLogin)
 		user.POST("/user_register", UserRegister)
+		user.POST("/refresh", RefreshUserToken)
+		user.POST("/logout", UserLogout)
+	}
+
+	// 后台接口需要登录，每个接口声明所需的权限
+	admin := r.Group("/admin", AuthRequired())
+	{
+		admin.POST("/add_dish", RequirePermission(PermMenuWrite), AddDish)
+		admin.PUT("/update_dish", RequirePermission(PermMenuWrite), UpdateDish)
+		admin.DELETE("/delete_dish", RequirePermission(PermMenuWrite), DeleteDish)
+		admin.POST("/dishes/:id/image", RequirePermission(PermMenuWrite), UploadDishImage)
+		admin.PUT("/dishes/:id/availability", RequirePermission(PermMenuStock), UpdateDishAvailability)
+		admin.POST("/dishes/:id/option_groups", RequirePermission(PermMenuWrite), AddOptionGroup)
+		admin.PUT("/option_groups/:id", RequirePermission(PermMenuWrite), UpdateOptionGroup)
+		admin.DELETE("/option_groups/:id", RequirePermission(PermMenuWrite), DeleteOptionGroup)
+		admin.GET("/promotions", RequirePermission(PermPromotionsWrite), GetAllPromotions)
+		admin.POST("/promotions", RequirePermission(PermPromotionsWrite), AddPromotion)
+		admin.PUT("/promotions/:id", RequirePermission(PermPromotionsWrite), UpdatePromotion)
+		admin.DELETE("/promotions/:id", RequirePermission(PermPromotionsWrite), DeletePromotion)
+		admin.GET("/orders", RequirePermission(PermOrdersRead), GetAllOrders)
+		admin.GET("/orders/:id", RequirePermission(PermOrdersRead), GetOrderDetail)
+		// 变更到不同状态还需要的权限见 transitionPermissions
+		admin.POST("/orders/:id/transition", RequirePermission(PermOrdersRead), TransitionOrder)
+		admin.GET("/tables", RequirePermission(PermTablesWrite), GetAllTables)
+		admin.POST("/tables", RequirePermission(PermTablesWrite), AddTable)
+		admin.PUT("/tables/:id", RequirePermission(PermTablesWrite), UpdateTable)
+		admin.DELETE("/tables/:id", RequirePermission(PermTablesWrite), DeleteTable)
+		admin.GET("/tables/:id/qrcode", RequirePermission(PermTablesWrite), GetTableQRCode)
+		admin.GET("/stations", RequirePermission(PermMenuWrite), GetAllStations)
+		admin.POST("/stations", RequirePermission(PermMenuWrite), AddStation)
+		admin.PUT("/stations/:id", RequirePermission(PermMenuWrite), UpdateStation)
+		admin.DELETE("/stations/:id", RequirePermission(PermMenuWrite), DeleteStation)
+		admin.GET("/categories", RequirePermission(PermMenuWrite), GetAllCategories)
+		admin.POST("/categories", RequirePermission(PermMenuWrite), AddCategory)
+		admin.PUT("/categories/reorder", RequirePermission(PermMenuWrite), ReorderCategories)
+		admin.PUT("/categories/:id", RequirePermission(PermMenuWrite), UpdateCategory)
+		admin.DELETE("/categories/:id", RequirePermission(PermMenuWrite), DeleteCategory)
+		admin.PUT("/categories/:id/dishes/reorder", RequirePermission(PermMenuWrite), ReorderDishes)
+		admin.GET("/menus", RequirePermission(PermMenuWrite), GetAllMenus)
+		admin.POST("/menus", RequirePermission(PermMenuWrite), AddMenu)
+		admin.GET("/menus/preview", RequirePermission(PermMenuWrite), PreviewMenu)
+		admin.PUT("/menus/:id", RequirePermission(PermMenuWrite), UpdateMenu)
+		admin.DELETE("/menus/:id", RequirePermission(PermMenuWrite), DeleteMenu)
+		admin.GET("/ingredients", RequirePermission(PermInventoryWrite), GetAllIngredients)
+		admin.POST("/ingredients", RequirePermission(PermInventoryWrite), AddIngredient)
+		admin.PUT("/ingredients/:id", RequirePermission(PermInventoryWrite), UpdateIngredient)
+		admin.DELETE("/ingredients/:id", RequirePermission(PermInventoryWrite), DeleteIngredient)
+		admin.POST("/ingredients/:id/adjust", RequirePermission(PermInventoryWrite), AdjustIngredient)
+		admin.GET("/stock_movements", RequirePermission(PermInventoryWrite), GetStockMovements)
+		admin.GET("/dishes/:id/recipe", RequirePermission(PermInventoryWrite), GetRecipe)
+		admin.PUT("/dishes/:id/recipe", RequirePermission(PermInventoryWrite), UpdateRecipe)
+		admin.GET("/reports/low_stock", RequirePermission(PermReportsRead), GetLowStockReport)
+		admin.GET("/reports/sales", RequirePermission(PermReportsRead), GetSalesReport)
+		admin.GET("/exports/orders", RequirePermission(PermReportsRead), ExportOrders)
+		admin.GET("/exports/records", RequirePermission(PermReportsRead), ExportRecords)
+		admin.GET("/exports/reports/:name", RequirePermission(PermReportsRead), ExportReport)
+		admin.GET("/roles", RequirePermission(PermUsersWrite), GetRoles)
+		admin.GET("/users", RequirePermission(PermUsersWrite), GetAllUsers)
+		admin.PUT("/users/:id/role", RequirePermission(PermUsersWrite), AssignRole)
 	}
 
-	admin := r.Group("/admin")
+	// 后厨实时推送和工位队列，推送按工位过滤，支持断线续传
+	// 只有推送接口接受查询参数 access_token
+	feed := r.Group("/kitchen/feed", StreamAuthRequired(), RequirePermission(PermOrdersRead))
+	{
+		feed.GET("/sse", KitchenFeedSSE)
+		feed.GET("/ws", KitchenFeedWS)
+	}
+	kitchen := r.Group("/kitchen", AuthRequired(), RequirePermission(PermOrdersRead))
 	{
-		admin.POST("/add_dish", AddDish)
-		admin.PUT("/update_dish", UpdateDish)
-		admin.DELETE("/delete_dish", DeleteDish)
+		kitchen.GET("/stations", GetAllStations)
+		kitchen.GET("/stations/:id/queue", GetStationQueue)
+		kitchen.GET("/orders/:id/items", GetOrderItems)
+		kitchen.POST("/items/:id/start", RequirePermission(PermOrdersUpdate), StartItem)
+		kitchen.POST("/items/:id/done", RequirePermission(PermOrdersUpdate), FinishItem)
 	}
 
 	return r
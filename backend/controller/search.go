@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"example.com/m/v2/global"
+	"github.com/mozillazg/go-pinyin"
+)
+
+// 搜索热度统计最近多少天的销量
+const searchPopularityDays = 30
+
+// 热度加分的上限，要小于相邻匹配等级之间的分差，见 rankDishes
+const maxPopularityBonus = 15
+
+// dishPinyin 菜名的拼音，Full 为全拼（如 huiguorou），Initials 为首字母（如 hgr）
+type dishPinyin struct {
+	Full     string
+	Initials string
+}
+
+// 菜名很少变化，拼音按菜名缓存
+var pinyinCache sync.Map
+
+func pinyinOf(name string) dishPinyin {
+	if cached, ok := pinyinCache.Load(name); ok {
+		return cached.(dishPinyin)
+	}
+	args := pinyin.NewArgs()
+	// 非汉字（字母、数字）原样保留
+	args.Fallback = func(r rune, a pinyin.Args) []string {
+		if unicode.IsSpace(r) {
+			return nil
+		}
+		return []string{string(unicode.ToLower(r))}
+	}
+	var full, initials strings.Builder
+	for _, syllable := range pinyin.LazyPinyin(name, args) {
+		if syllable == "" {
+			continue
+		}
+		full.WriteString(syllable)
+		initials.WriteRune([]rune(syllable)[0])
+	}
+	result := dishPinyin{Full: full.String(), Initials: initials.String()}
+	pinyinCache.Store(name, result)
+	return result
+}
+
+// matchScore 计算菜名与关键词的匹配度，不匹配返回 0
+//
+// 备注：
+//
+//	按菜名完全相同、前缀、包含，拼音首字母前缀、全拼前缀、首字母包含、全拼包含，
+//	最后是按顺序包含关键词的每个字（如“回肉”匹配“回锅肉”）依次降低
+func matchScore(name string, query string) float64 {
+	name = strings.ToLower(name)
+	switch {
+	case name == query:
+		return 100
+	case strings.HasPrefix(name, query):
+		return 80
+	case strings.Contains(name, query):
+		return 60
+	}
+	compact := strings.ReplaceAll(query, " ", "")
+	if compact == "" {
+		return 0
+	}
+	py := pinyinOf(name)
+	switch {
+	case strings.HasPrefix(py.Initials, compact):
+		return 50
+	case strings.HasPrefix(py.Full, compact):
+		return 45
+	case strings.Contains(py.Initials, compact):
+		return 40
+	case strings.Contains(py.Full, compact):
+		return 35
+	case isSubsequence(name, compact) || isSubsequence(py.Initials, compact):
+		return 20
+	}
+	return 0
+}
+
+func isSubsequence(s string, sub string) bool {
+	target := []rune(sub)
+	i := 0
+	for _, r := range s {
+		if i < len(target) && r == target[i] {
+			i++
+		}
+	}
+	return i == len(target)
+}
+
+// loadDishSales 统计最近 days 天各菜品的销量，不含取消、作废和退款的订单
+func loadDishSales(dishIDs []uint, days int) (map[uint]int, error) {
+	var rows []struct {
+		DishID uint
+		Total  int
+	}
+	err := global.DB.Table("records").
+		Select("records.dish_id, SUM(records.count) AS total").
+		Joins("JOIN orders ON orders.id = records.order_id").
+		Where("records.dish_id IN ?", dishIDs).
+		Where("orders.status NOT IN ?", []string{OrderStatusCancelled, OrderStatusVoided, OrderStatusRefunded}).
+		Where("orders.created_at >= ?", time.Now().AddDate(0, 0, -days)).
+		Group("records.dish_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	sales := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		sales[row.DishID] = row.Total
+	}
+	return sales, nil
+}
+
+// rankDishes 过滤出匹配关键词的菜品，按匹配度加热度排序
+//
+// 备注：
+//
+//	热度加分为 15·销量/(销量+20)，销量 20 份加 7.5 分，销量再高也不到 15 分，
+//	小于包含匹配与菜名前缀匹配之间的 20 分，不会让弱匹配压过菜名前缀匹配
+func rankDishes(dishes []Dish, query string, sales map[uint]int) []Dish {
+	query = strings.ToLower(strings.TrimSpace(query))
+	type scored struct {
+		dish  Dish
+		score float64
+	}
+	matched := make([]scored, 0, len(dishes))
+	for _, dish := range dishes {
+		score := matchScore(dish.Name, query)
+		if score == 0 {
+			continue
+		}
+		n := float64(sales[dish.ID])
+		score += maxPopularityBonus * n / (n + 20)
+		matched = append(matched, scored{dish, score})
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].score != matched[j].score {
+			return matched[i].score > matched[j].score
+		}
+		return matched[i].dish.ID < matched[j].dish.ID
+	})
+	result := make([]Dish, len(matched))
+	for i := range matched {
+		result[i] = matched[i].dish
+	}
+	return result
+}
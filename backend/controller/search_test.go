@@ -0,0 +1,95 @@
+package controller
+
+import "testing"
+
+func TestPinyinOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		full     string
+		initials string
+	}{
+		{"回锅肉", "huiguorou", "hgr"},
+		{"宫保鸡丁", "gongbaojiding", "gbjd"},
+		{"冰可乐 Cola", "bingkelecola", "bklcola"},
+		{"3号套餐", "3haotaocan", "3htc"},
+	}
+	for _, tt := range tests {
+		got := pinyinOf(tt.name)
+		if got.Full != tt.full || got.Initials != tt.initials {
+			t.Errorf("pinyinOf(%q) = %+v, want {Full:%s Initials:%s}", tt.name, got, tt.full, tt.initials)
+		}
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		query string
+		want  float64
+	}{
+		{"回锅肉", 100},
+		{"回锅", 80},
+		{"锅肉", 60},
+		{"hg", 50},
+		{"huiguo", 45},
+		{"gr", 40},
+		{"guorou", 35},
+		{"hui guo", 45}, // 拼音中的空格忽略
+		{"回肉", 20},
+		{"hr", 20},
+		{"鱼香", 0},
+		{"xyz", 0},
+	}
+	for _, tt := range tests {
+		if got := matchScore("回锅肉", tt.query); got != tt.want {
+			t.Errorf("matchScore(%q, %q) = %v, want %v", "回锅肉", tt.query, got, tt.want)
+		}
+	}
+	// 菜名中的英文不区分大小写
+	if got := matchScore("Coca Cola", "coca cola"); got != 100 {
+		t.Errorf("matchScore() = %v, want 100", got)
+	}
+}
+
+func TestRankDishes(t *testing.T) {
+	dishes := []Dish{
+		{ID: 1, Name: "鱼香肉丝"},
+		{ID: 2, Name: "红烧肉"},
+		{ID: 3, Name: "肉夹馍"},
+		{ID: 4, Name: "回锅肉"},
+		{ID: 5, Name: "青菜"},
+	}
+	// 肉夹馍是前缀匹配，其余包含“肉”，同为包含时按销量排序
+	ranked := rankDishes(dishes, " 肉 ", map[uint]int{2: 10, 4: 5})
+	want := []uint{3, 2, 4, 1}
+	if len(ranked) != len(want) {
+		t.Fatalf("rankDishes() returned %d dishes, want %d", len(ranked), len(want))
+	}
+	for i, id := range want {
+		if ranked[i].ID != id {
+			t.Errorf("rankDishes()[%d] = %d (%s), want %d", i, ranked[i].ID, ranked[i].Name, id)
+		}
+	}
+}
+
+func TestRankDishesPopularityBonus(t *testing.T) {
+	dishes := []Dish{
+		{ID: 1, Name: "红烧肉"},
+		{ID: 2, Name: "肉夹馍"},
+		{ID: 3, Name: "回锅肉"},
+	}
+	// 销量再高的包含匹配也排在没有销量的前缀匹配之后
+	for _, n := range []int{10, 100, 400, 100000} {
+		ranked := rankDishes(dishes, "肉", map[uint]int{1: n})
+		if ranked[0].ID != 2 {
+			t.Errorf("sales %d: rankDishes()[0] = %s, want the prefix match 肉夹馍", n, ranked[0].Name)
+		}
+		if ranked[1].ID != 1 {
+			t.Errorf("sales %d: rankDishes()[1] = %s, want the popular contains match 红烧肉", n, ranked[1].Name)
+		}
+	}
+	// 同一匹配等级内销量高的靠前，销量很高时仍能区分
+	ranked := rankDishes(dishes, "肉", map[uint]int{1: 5000, 3: 8000})
+	if ranked[1].ID != 3 || ranked[2].ID != 1 {
+		t.Errorf("rankDishes() = %v, want 回锅肉 ahead of 红烧肉", []string{ranked[0].Name, ranked[1].Name, ranked[2].Name})
+	}
+}
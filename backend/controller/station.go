@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"gorm.io/gorm"
+)
+
+// 菜品制作状态
+const (
+	ItemStatusPending = "pending" // 待制作
+	ItemStatusStarted = "started" // 制作中
+	ItemStatusDone    = "done"    // 已出品
+)
+
+// stationRouter 根据工位路由决定每道菜由哪个工位制作
+type stationRouter struct {
+	byDish     map[uint]uint
+	byCategory map[uint]uint
+	categories *CategoryTree
+}
+
+// loadStationRouter 加载所有工位路由
+func loadStationRouter(db *gorm.DB) (*stationRouter, error) {
+	var routes []StationRoute
+	if err := db.Find(&routes).Error; err != nil {
+		return nil, err
+	}
+	categories, err := LoadCategoryTree(db)
+	if err != nil {
+		return nil, err
+	}
+	router := &stationRouter{
+		byDish:     map[uint]uint{},
+		byCategory: map[uint]uint{},
+		categories: categories,
+	}
+	for _, route := range routes {
+		if route.DishID != 0 {
+			router.byDish[route.DishID] = route.StationID
+		} else if route.CategoryID != 0 {
+			router.byCategory[route.CategoryID] = route.StationID
+		}
+	}
+	return router, nil
+}
+
+// StationFor 返回制作该菜品的工位，指定菜品优先于指定分类，分类没有配置时按最近的上级分类，都没有配置时为 0
+func (router *stationRouter) StationFor(dish *Dish) uint {
+	if id, ok := router.byDish[dish.ID]; ok {
+		return id
+	}
+	for _, categoryID := range router.categories.Lineage(dish.CategoryID) {
+		if id, ok := router.byCategory[categoryID]; ok {
+			return id
+		}
+	}
+	return 0
+}
+
+// CanChangeItemStatus 判断菜品能否从 from 变更到 to，待制作可以直接出品
+func CanChangeItemStatus(from string, to string) bool {
+	switch to {
+	case ItemStatusStarted:
+		return from == ItemStatusPending
+	case ItemStatusDone:
+		return from == ItemStatusPending || from == ItemStatusStarted
+	}
+	return false
+}
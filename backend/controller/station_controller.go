@@ -0,0 +1,311 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errIllegalItemStatus = errors.New("illegal item status change")
+
+// errOrderFinished 订单已支付、取消或作废，菜品不能再变更
+var errOrderFinished = errors.New("order is finished")
+
+// StationQueueItem 工位队列中的一道菜
+type StationQueueItem struct {
+	KitchenItem
+	OrderID   uint
+	TableNo   string
+	Time      string // 下单时间
+	StartedAt *time.Time
+}
+
+// checkStation 校验工位路由，每条路由必须指定分类或菜品之一
+func checkStation(ctx *gin.Context, station *Station) bool {
+	for _, route := range station.Routes {
+		if (route.CategoryID == 0) == (route.DishID == 0) {
+			ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+				"error": "工位路由需要指定分类或菜品之一",
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// AddStation 添加工位，请求体中的 Routes 一起创建
+func AddStation(ctx *gin.Context) {
+	var station Station
+	if ok := BindJSON(ctx, &station); !ok {
+		return
+	}
+	station.ID = 0
+	for i := range station.Routes {
+		station.Routes[i].ID = 0
+	}
+	if ok := checkStation(ctx, &station); !ok {
+		return
+	}
+	if ok := CreateDataWithoutBind(ctx, &station); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, station)
+}
+
+// GetAllStations 获取所有工位及其路由
+func GetAllStations(ctx *gin.Context) {
+	var stations []Station
+	if ok := GetAllDatas(ctx, &stations, nil, "Routes"); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, stations)
+}
+
+// UpdateStation 更新工位，请求体中的 Routes 会整体替换原有路由
+func UpdateStation(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var station Station
+	if ok := GetData(ctx, &station, map[string]interface{}{"id": id}); !ok {
+		return
+	}
+	stationID := station.ID
+	if ok := BindJSON(ctx, &station); !ok {
+		return
+	}
+	station.ID = stationID
+	for i := range station.Routes {
+		station.Routes[i].ID = 0
+		station.Routes[i].StationID = stationID
+	}
+	if ok := checkStation(ctx, &station); !ok {
+		return
+	}
+
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("name").Omit("Routes").Updates(&station).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("station_id = ?", stationID).Delete(&StationRoute{}).Error; err != nil {
+			return err
+		}
+		if len(station.Routes) == 0 {
+			return nil
+		}
+		return tx.Create(&station.Routes).Error
+	})
+	if err != nil {
+		log.Println()
+		log.Printf("Update station error\n")
+		log.Printf("station: %+v\n", station)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "更新失败",
+		})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, station)
+}
+
+// DeleteStation 删除工位及其路由，已下单的菜品保留原工位
+func DeleteStation(ctx *gin.Context) {
+	id := ctx.Param("id")
+	iid, _ := strconv.Atoi(id)
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("station_id = ?", iid).Delete(&StationRoute{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Station{ID: uint(iid)}).Error
+	})
+	if err != nil {
+		log.Println()
+		log.Printf("Delete station error\n")
+		log.Printf("station: %s\n", id)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "删除错误",
+		})
+		return
+	}
+	log.Println()
+	log.Printf("Delete station: %s\n", id)
+	ctx.IndentedJSON(http.StatusNoContent, nil)
+}
+
+// GetStationQueue 获取工位待制作和制作中的菜品，按下单先后排序
+// 已取消、作废或结账的订单不在队列中
+func GetStationQueue(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var station Station
+	if ok := GetData(ctx, &station, map[string]interface{}{"id": id}); !ok {
+		return
+	}
+	var records []Record
+	err := global.DB.Preload("Options").
+		Joins("JOIN orders ON orders.id = records.order_id").
+		Where("records.station_id = ?", station.ID).
+		Where("records.status IN ?", []string{ItemStatusPending, ItemStatusStarted}).
+		Where("orders.status IN ?", []string{OrderStatusPlaced, OrderStatusAccepted, OrderStatusCooking}).
+		Order("records.id").
+		Find(&records).Error
+	if err != nil {
+		log.Println()
+		log.Printf("Get station queue error\n")
+		log.Printf("station: %d\n", station.ID)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询失败",
+		})
+		return
+	}
+	queue, ok := buildStationQueue(ctx, records)
+	if !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, queue)
+}
+
+// GetOrderItems 获取订单中每道菜的制作进度，供传菜查看还有哪些菜没出
+func GetOrderItems(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var order Order
+	if ok := GetData(ctx, &order, map[string]interface{}{"id": id}, "Records.Options"); !ok {
+		return
+	}
+	queue, ok := buildStationQueue(ctx, order.Records)
+	if !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, gin.H{
+		"order_id": order.ID,
+		"table_no": order.TableNo,
+		"status":   order.Status,
+		"items":    queue,
+	})
+}
+
+// buildStationQueue 把订单明细转换为带桌号的队列项
+func buildStationQueue(ctx *gin.Context, records []Record) ([]StationQueueItem, bool) {
+	items, err := BuildKitchenItems(records)
+	orderIDs := make([]uint, 0, len(records))
+	for _, record := range records {
+		orderIDs = append(orderIDs, record.OrderID)
+	}
+	var orders []Order
+	if err == nil && len(orderIDs) > 0 {
+		err = global.DB.Select("id", "table_no").Find(&orders, orderIDs).Error
+	}
+	if err != nil {
+		log.Println()
+		log.Printf("Build station queue error\n")
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询失败",
+		})
+		return nil, false
+	}
+	tableNos := make(map[uint]string, len(orders))
+	for _, order := range orders {
+		tableNos[order.ID] = order.TableNo
+	}
+
+	queue := make([]StationQueueItem, 0, len(records))
+	for i, record := range records {
+		queue = append(queue, StationQueueItem{
+			KitchenItem: items[i],
+			OrderID:     record.OrderID,
+			TableNo:     tableNos[record.OrderID],
+			Time:        record.Time,
+			StartedAt:   record.StartedAt,
+		})
+	}
+	return queue, true
+}
+
+// StartItem 标记菜品开始制作
+func StartItem(ctx *gin.Context) {
+	changeItemStatus(ctx, ItemStatusStarted)
+}
+
+// FinishItem 标记菜品已出品
+func FinishItem(ctx *gin.Context) {
+	changeItemStatus(ctx, ItemStatusDone)
+}
+
+// changeItemStatus 在事务中锁定菜品行并变更制作状态，成功后推送给后厨
+// 非法变更或订单已结束返回 409
+func changeItemStatus(ctx *gin.Context, to string) {
+	id, _ := strconv.Atoi(ctx.Param("id"))
+	var record Record
+	var order Order
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id", "order_id").First(&record, id).Error; err != nil {
+			return err
+		}
+		// 先锁订单再锁菜品，和订单状态变更的加锁顺序一致；共享锁防止变更期间订单被取消
+		if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Select("id", "status").First(&order, record.OrderID).Error; err != nil {
+			return err
+		}
+		if orderFinished(order.Status) {
+			return errOrderFinished
+		}
+		// 加行锁，防止两个厨师同时操作同一道菜
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&record, id).Error; err != nil {
+			return err
+		}
+		if !CanChangeItemStatus(record.Status, to) {
+			return errIllegalItemStatus
+		}
+		now := time.Now()
+		from := record.Status
+		record.Status = to
+		if from == ItemStatusPending {
+			record.StartedAt = &now
+		}
+		if to == ItemStatusDone {
+			record.DoneAt = &now
+		}
+		return tx.Select("status", "started_at", "done_at").Omit("Options").Updates(&record).Error
+	})
+	if err != nil {
+		log.Println()
+		log.Printf("Change item status error\n")
+		log.Printf("record: %d, from: %s, to: %s\n", id, record.Status, to)
+		log.Printf("error: %s\n", err.Error())
+		log.Println()
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ctx.IndentedJSON(http.StatusNotFound, gin.H{
+				"error": "菜品不存在",
+			})
+		case errors.Is(err, errOrderFinished):
+			ctx.IndentedJSON(http.StatusConflict, gin.H{
+				"error":        "订单已结束，菜品状态不能再变更",
+				"order_status": order.Status,
+			})
+		case errors.Is(err, errIllegalItemStatus):
+			ctx.IndentedJSON(http.StatusConflict, gin.H{
+				"error":  "菜品状态不允许此变更",
+				"status": record.Status,
+			})
+		default:
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+				"error": "菜品状态变更失败",
+			})
+		}
+		return
+	}
+
+	PublishItemEvent(record.OrderID, record.ID)
+	ctx.IndentedJSON(http.StatusOK, record)
+}
@@ -0,0 +1,53 @@
+package controller
+
+import "testing"
+
+func TestStationFor(t *testing.T) {
+	router := &stationRouter{
+		byDish:     map[uint]uint{5: 3},
+		byCategory: map[uint]uint{10: 1, 11: 2, 1: 4},
+		categories: testCategories(),
+	}
+	tests := []struct {
+		name string
+		dish Dish
+		want uint
+	}{
+		{"指定菜品优先", Dish{ID: 5, CategoryID: 11}, 3},
+		{"子分类有自己的路由", Dish{ID: 6, CategoryID: 11}, 2},
+		{"按分类", Dish{ID: 7, CategoryID: 10}, 1},
+		{"没有配置", Dish{ID: 8, CategoryID: 2}, 0},
+		{"未分类", Dish{ID: 9}, 0},
+	}
+	for _, tt := range tests {
+		if got := router.StationFor(&tt.dish); got != tt.want {
+			t.Errorf("%s: StationFor() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	// 子分类没有路由时按上级分类
+	delete(router.byCategory, 11)
+	if got := router.StationFor(&Dish{ID: 6, CategoryID: 11}); got != 1 {
+		t.Errorf("StationFor() = %d, want the parent category's station 1", got)
+	}
+}
+
+func TestCanChangeItemStatus(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{ItemStatusPending, ItemStatusStarted, true},
+		{ItemStatusPending, ItemStatusDone, true},
+		{ItemStatusStarted, ItemStatusDone, true},
+		{ItemStatusStarted, ItemStatusStarted, false},
+		{ItemStatusDone, ItemStatusStarted, false},
+		{ItemStatusDone, ItemStatusDone, false},
+		{ItemStatusStarted, ItemStatusPending, false},
+	}
+	for _, tt := range tests {
+		if got := CanChangeItemStatus(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanChangeItemStatus(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
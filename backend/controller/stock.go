@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// BusinessDay 返回 t 所属的营业日，营业日分界之前算作前一天
+func BusinessDay(t time.Time) string {
+	t = t.In(global.MENU_CONFIG.Location)
+	start, _ := time.Parse("15:04", global.MENU_CONFIG.BusinessDayStart)
+	if t.Hour()*60+t.Minute() < start.Hour()*60+start.Minute() {
+		t = t.AddDate(0, 0, -1)
+	}
+	return t.Format("2006-01-02")
+}
+
+var (
+	stockMu       sync.Mutex
+	stockResetDay string // 本进程最近一次重置库存的营业日
+)
+
+// ResetDailyStock 进入新的营业日后重置每日库存和售罄状态
+//
+// 备注：
+//
+//	每个进程每个营业日只执行一次；条件更新只影响 stock_day 不是今天的菜品，多个实例同时执行也只会重置一次；
+//	总是直接更新数据库，不能放在下单事务中，否则事务回滚后本进程当天不会再重置
+func ResetDailyStock() error {
+	day := BusinessDay(time.Now())
+	stockMu.Lock()
+	defer stockMu.Unlock()
+	if stockResetDay == day {
+		return nil
+	}
+	err := global.DB.Model(&Dish{}).
+		Where("stock_day <> ? OR stock_day IS NULL", day).
+		Updates(map[string]interface{}{
+			"stock":     gorm.Expr("daily_stock"),
+			"sold_out":  false,
+			"stock_day": day,
+		}).Error
+	if err != nil {
+		return err
+	}
+	stockResetDay = day
+	return nil
+}
+
+// initDishStock 新建菜品或修改每日份数时把今日剩余初始化为每日份数，否则要到下个营业日才能点
+// changed 为 false 时只标记营业日，不改变剩余份数
+func initDishStock(dish *Dish, changed bool) {
+	if changed && dish.DailyStock > 0 && dish.Stock == 0 {
+		dish.Stock = dish.DailyStock
+	}
+	dish.StockDay = BusinessDay(time.Now())
+}
+
+// checkStock 校验同一菜品所有行的份数合计不超过今日剩余，超出时在该菜品的第一行报错
+// 只用于提前给出友好的错误，最终以 reserveStock 的条件更新为准
+func checkStock(bills []Bill, dishes []*Dish) BillErrors {
+	counts := map[uint]int{}
+	for _, bill := range bills {
+		counts[bill.DishID] += bill.Count
+	}
+	var errs BillErrors
+	for line, dish := range dishes {
+		count, ok := counts[dish.ID]
+		if !ok {
+			continue
+		}
+		delete(counts, dish.ID)
+		if dish.DailyStock > 0 && count > dish.Stock {
+			errs = append(errs, &BillError{Line: line, DishID: dish.ID, Msg: soldOutMsg(dish)})
+		}
+	}
+	return errs
+}
+
+// soldOutMsg 售罄或库存不足时的提示
+func soldOutMsg(dish *Dish) string {
+	if dish.SoldOut || (dish.DailyStock > 0 && dish.Stock <= 0) {
+		return dish.Name + "已售罄"
+	}
+	return fmt.Sprintf("%s今日仅剩%d份", dish.Name, dish.Stock)
+}
+
+// reserveStock 在下单事务中扣减每日库存，用完时自动标记售罄
+//
+// 备注：
+//
+//	扣减是条件更新，并发下单也不会超卖；剩余不足时返回 *BillError，整个订单回滚
+func reserveStock(tx *gorm.DB, quote *Quote) error {
+	counts := map[uint]int{}
+	for _, record := range quote.records {
+		counts[record.DishID] += record.Count
+	}
+	for line, dish := range quote.dishes {
+		count, ok := counts[dish.ID]
+		if !ok || dish.DailyStock == 0 {
+			continue
+		}
+		delete(counts, dish.ID)
+		result := tx.Model(&Dish{}).
+			Where("id = ? AND sold_out = ? AND stock >= ?", dish.ID, false, count).
+			Update("stock", gorm.Expr("stock - ?", count))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// 被并发的订单抢先，重新读取剩余份数给出提示
+			var latest Dish
+			if err := tx.First(&latest, dish.ID).Error; err != nil {
+				return err
+			}
+			return &BillError{Line: line, DishID: dish.ID, Msg: soldOutMsg(&latest)}
+		}
+		if err := tx.Model(&Dish{}).Where("id = ? AND stock <= 0", dish.ID).
+			Update("sold_out", true).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DishAvailability 更新菜品上架、售罄和每日库存的请求体，未提供的字段不变
+type DishAvailability struct {
+	Available  *bool
+	SoldOut    *bool
+	DailyStock *int // 修改后今日剩余份数同时重置为该值，除非同时提供 Stock
+	Stock      *int
+}
+
+// UpdateDishAvailability 上架/下架、估清/恢复售卖、设置每日份数
+func UpdateDishAvailability(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var dish Dish
+	if ok := GetData(ctx, &dish, map[string]interface{}{"id": id}); !ok {
+		return
+	}
+	var body DishAvailability
+	if ok := BindJSON(ctx, &body); !ok {
+		return
+	}
+	if (body.DailyStock != nil && *body.DailyStock < 0) || (body.Stock != nil && *body.Stock < 0) {
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": "份数不能为负",
+		})
+		return
+	}
+	resetDailyStock()
+
+	updates := map[string]interface{}{"stock_day": BusinessDay(time.Now())}
+	if body.Available != nil {
+		updates["available"] = *body.Available
+	}
+	if body.SoldOut != nil {
+		updates["sold_out"] = *body.SoldOut
+	}
+	if body.DailyStock != nil {
+		updates["daily_stock"] = *body.DailyStock
+		updates["stock"] = *body.DailyStock
+	}
+	if body.Stock != nil {
+		updates["stock"] = *body.Stock
+	}
+	// 补充库存后自动解除售罄，手动指定 SoldOut 时以指定为准
+	if stock, ok := updates["stock"].(int); ok && body.SoldOut == nil {
+		dailyStock := dish.DailyStock
+		if body.DailyStock != nil {
+			dailyStock = *body.DailyStock
+		}
+		updates["sold_out"] = dailyStock > 0 && stock <= 0
+	}
+	if err := global.DB.Model(&dish).Updates(updates).Error; err != nil {
+		log.Println()
+		log.Printf("Update dish availability error\n")
+		log.Printf("dish: %d, updates: %+v\n", dish.ID, updates)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "更新失败",
+		})
+		return
+	}
+	if err := global.DB.First(&dish, dish.ID).Error; err != nil {
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "查询失败",
+		})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, dish)
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"example.com/m/v2/global"
+)
+
+// setMenuConfig 在测试期间替换营业时区和营业日分界
+func setMenuConfig(t *testing.T, timezone string, dayStart string) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		t.Fatalf("load location %q: %v", timezone, err)
+	}
+	saved := *global.MENU_CONFIG
+	t.Cleanup(func() { *global.MENU_CONFIG = saved })
+	global.MENU_CONFIG.Timezone = timezone
+	global.MENU_CONFIG.Location = location
+	global.MENU_CONFIG.BusinessDayStart = dayStart
+	return location
+}
+
+func TestBusinessDay(t *testing.T) {
+	shanghai := setMenuConfig(t, "Asia/Shanghai", "04:00")
+	tests := []struct {
+		name string
+		t    time.Time
+		want string
+	}{
+		{"白天", time.Date(2026, 10, 18, 12, 0, 0, 0, shanghai), "2026-10-18"},
+		{"分界之前算前一天", time.Date(2026, 10, 18, 3, 59, 0, 0, shanghai), "2026-10-17"},
+		{"分界时刻", time.Date(2026, 10, 18, 4, 0, 0, 0, shanghai), "2026-10-18"},
+		{"午夜", time.Date(2026, 10, 18, 0, 0, 0, 0, shanghai), "2026-10-17"},
+		{"跨月", time.Date(2026, 11, 1, 1, 0, 0, 0, shanghai), "2026-10-31"},
+		// UTC 19:30 为上海次日 03:30，仍属于上海的前一个营业日
+		{"按营业时区换算", time.Date(2026, 10, 18, 19, 30, 0, 0, time.UTC), "2026-10-18"},
+		{"按营业时区换算后过了分界", time.Date(2026, 10, 18, 20, 30, 0, 0, time.UTC), "2026-10-19"},
+	}
+	for _, tt := range tests {
+		if got := BusinessDay(tt.t); got != tt.want {
+			t.Errorf("%s: BusinessDay(%s) = %s, want %s", tt.name, tt.t.Format(time.RFC3339), got, tt.want)
+		}
+	}
+}
+
+func TestCheckStock(t *testing.T) {
+	dishes := []*Dish{
+		{ID: 1, Name: "牛肉面", DailyStock: 10, Stock: 3},
+		{ID: 2, Name: "奶茶"},
+		{ID: 1, Name: "牛肉面", DailyStock: 10, Stock: 3},
+	}
+	// 同一菜品分两行点，合计超过剩余时在第一行报错
+	errs := checkStock([]Bill{{DishID: 1, Count: 2}, {DishID: 2, Count: 50}, {DishID: 1, Count: 2}}, dishes)
+	if len(errs) != 1 || errs[0].Line != 0 || errs[0].Msg != "牛肉面今日仅剩3份" {
+		t.Fatalf("checkStock() = %v, want one error on line 0", errs)
+	}
+	if errs := checkStock([]Bill{{DishID: 1, Count: 1}, {DishID: 2, Count: 50}, {DishID: 1, Count: 2}}, dishes); len(errs) != 0 {
+		t.Fatalf("checkStock() = %v, want no errors", errs)
+	}
+}
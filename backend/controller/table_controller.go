@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"example.com/m/v2/global"
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+)
+
+// TableTokenHeader 顾客端携带桌号令牌的请求头，也可以用查询参数 table_token
+const TableTokenHeader = "X-Table-Token"
+
+// signTable 对桌子的 ID 和桌号签名，桌号变更后旧令牌自动失效
+func signTable(table *Table) string {
+	mac := hmac.New(sha256.New, []byte(global.TABLE_CONFIG.Secret))
+	fmt.Fprintf(mac, "table:%d:%s", table.ID, table.Number)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// TableToken 生成桌号令牌，格式为 "<table id>.<签名>"，二维码中编码的就是它
+func TableToken(table *Table) string {
+	return fmt.Sprintf("%d.%s", table.ID, signTable(table))
+}
+
+// TableOrderURL 生成二维码指向的点餐地址
+func TableOrderURL(table *Table) string {
+	orderURL := global.TABLE_CONFIG.OrderURL
+	sep := "?"
+	if strings.Contains(orderURL, "?") {
+		sep = "&"
+	}
+	return orderURL + sep + "table_token=" + url.QueryEscape(TableToken(table))
+}
+
+// GetTableFromToken 从请求头或查询参数中读取桌号令牌并校验
+//
+// 参数：
+//
+//	ctx *gin.Context: Gin 框架的上下文对象
+//	table *Table: 校验通过后填充对应的桌子
+//
+// 返回值：
+//
+//	bool: 令牌有效且桌子启用时返回 true；否则返回 false，并已写入错误响应
+func GetTableFromToken(ctx *gin.Context, table *Table) bool {
+	token := ctx.GetHeader(TableTokenHeader)
+	if token == "" {
+		token = ctx.Query("table_token")
+	}
+	id, sig, found := strings.Cut(token, ".")
+	iid, err := strconv.ParseUint(id, 10, 64)
+	if !found || err != nil {
+		log.Printf("Invalid table token: %q\n", token)
+		ctx.IndentedJSON(http.StatusBadRequest, gin.H{
+			"error": "缺少或无效的桌号，请重新扫码",
+		})
+		return false
+	}
+	if err := global.DB.First(table, iid).Error; err != nil ||
+		!hmac.Equal([]byte(sig), []byte(signTable(table))) {
+		log.Printf("Forged table token: %q\n", token)
+		ctx.IndentedJSON(http.StatusForbidden, gin.H{
+			"error": "桌号校验失败，请重新扫码",
+		})
+		return false
+	}
+	if !table.Active {
+		ctx.IndentedJSON(http.StatusForbidden, gin.H{
+			"error": "该桌暂停使用",
+		})
+		return false
+	}
+	return true
+}
+
+// GetCurrentTable 根据扫码得到的令牌返回当前桌子信息
+func GetCurrentTable(ctx *gin.Context) {
+	var table Table
+	if ok := GetTableFromToken(ctx, &table); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, table)
+}
+
+// AddTable 添加桌子，未提供 Active 时默认启用
+func AddTable(ctx *gin.Context) {
+	table := Table{Active: true}
+	if ok := CreateData(ctx, &table); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, table)
+}
+
+// GetAllTables 获取所有桌子
+func GetAllTables(ctx *gin.Context) {
+	var tables []Table
+	if ok := GetAllDatas(ctx, &tables, nil); !ok {
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, tables)
+}
+
+// UpdateTable 更新桌子信息，Active 为 false 时也会写入
+func UpdateTable(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var table Table
+	if ok := GetData(ctx, &table, map[string]interface{}{"id": id}); !ok {
+		return
+	}
+	tableID := table.ID
+	if ok := BindJSON(ctx, &table); !ok {
+		return
+	}
+	table.ID = tableID
+	if err := global.DB.Select("number", "area", "seats", "active").Updates(&table).Error; err != nil {
+		log.Println()
+		log.Printf("Update table error\n")
+		log.Printf("table: %+v\n", table)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "更新失败",
+		})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, table)
+}
+
+// DeleteTable 删除桌子，已打印的二维码随之失效
+func DeleteTable(ctx *gin.Context) {
+	id := ctx.Param("id")
+	iid, _ := strconv.Atoi(id)
+	table := Table{ID: uint(iid)}
+	if ok := DeleteData(ctx, &table); !ok {
+		return
+	}
+	log.Println()
+	log.Printf("Delete table: %s\n", id)
+	ctx.IndentedJSON(http.StatusNoContent, nil)
+}
+
+// GetTableQRCode 生成桌子的点餐二维码 PNG，查询参数 size 为边长像素，默认 256
+func GetTableQRCode(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var table Table
+	if ok := GetData(ctx, &table, map[string]interface{}{"id": id}); !ok {
+		return
+	}
+	size, err := strconv.Atoi(ctx.DefaultQuery("size", "256"))
+	if err != nil || size < 64 || size > 2048 {
+		size = 256
+	}
+	png, err := qrcode.Encode(TableOrderURL(&table), qrcode.Medium, size)
+	if err != nil {
+		log.Println()
+		log.Printf("Encode qrcode error\n")
+		log.Printf("table: %+v\n", table)
+		log.Printf("%v\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "生成二维码失败",
+		})
+		return
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"table-%d.png\"", table.ID))
+	ctx.Data(http.StatusOK, "image/png", png)
+}
@@ -4,10 +4,12 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"time"
 
 	"example.com/m/v2/global"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func CheckUsername(ctx *gin.Context, username string) bool {
@@ -39,24 +41,35 @@ func CheckUsername(ctx *gin.Context, username string) bool {
 	return false
 }
 
+// UserRegister 注册用户，角色不能由请求指定
 func UserRegister(ctx *gin.Context) {
-	user := &User{}
+	var input struct {
+		Username string `binding:"required"`
+		Password string `binding:"required"`
+	}
+	if ok := BindJSON(ctx, &input); !ok {
+		return
+	}
 	// 检查是否存在相同用户名
-	if ok := CheckUsername(ctx, user.Username); !ok {
+	if ok := CheckUsername(ctx, input.Username); !ok {
 		return
 	}
 	// 使用ORM，不必担心sql注入
 	// 对密码进行加密
-	pwd, err := EncryptPassword(&(user.Password))
+	pwd, err := EncryptPassword(&(input.Password))
 	if err != nil {
 		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
 			"error": "密码解析失败",
 		})
 		return
 	}
-	user.Password = pwd
+	user := &User{
+		Username: input.Username,
+		Password: pwd,
+		Role:     RoleCustomer,
+	}
 
-	if ok := CreateData(ctx, user); !ok {
+	if ok := CreateDataWithoutBind(ctx, user); !ok {
 		return
 	}
 	// jwt token
@@ -109,9 +122,14 @@ func UserLogin(ctx *gin.Context) {
 		})
 		return
 	}
+	issueTokens(ctx, user)
+}
+
+// issueTokens 为用户签发 access token 和 refresh token 并写入响应
+func issueTokens(ctx *gin.Context, user *User) {
 	// jwt token
 	// 生成token
-	token, err := GenerateJWT(&(user.Username))
+	token, err := GenerateJWT(user)
 	if err != nil {
 		log.Println()
 		log.Printf("GenerateJWT error\n")
@@ -122,7 +140,105 @@ func UserLogin(ctx *gin.Context) {
 		})
 		return
 	}
+	refreshToken, hash, err := GenerateRefreshToken()
+	if err != nil {
+		log.Println()
+		log.Printf("GenerateRefreshToken error\n")
+		log.Printf("error: %s\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "生成token失败",
+		})
+		return
+	}
+	record := &RefreshToken{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(global.AUTH_CONFIG.RefreshTTL),
+	}
+	if ok := CreateDataWithoutBind(ctx, record); !ok {
+		return
+	}
 	ctx.IndentedJSON(http.StatusOK, gin.H{
-		"token": token,
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(global.AUTH_CONFIG.AccessTTL.Seconds()),
 	})
 }
+
+// RefreshUserToken 用 refresh token 换取新的 access token，
+// 旧的 refresh token 随即作废并返回新的 refresh token；
+// 已作废的 refresh token 被再次使用说明可能已泄露，此时作废该用户所有 refresh token
+func RefreshUserToken(ctx *gin.Context) {
+	var input struct {
+		RefreshToken string `binding:"required"`
+	}
+	if ok := BindJSON(ctx, &input); !ok {
+		return
+	}
+
+	var user User
+	var reused bool
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		var record RefreshToken
+		// 加行锁，防止同一个 refresh token 被并发使用两次
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", HashRefreshToken(input.RefreshToken)).
+			First(&record).Error; err != nil {
+			return err
+		}
+		if record.RevokedAt != nil {
+			reused = true
+			return tx.Model(&RefreshToken{}).
+				Where("user_id = ? AND revoked_at IS NULL", record.UserID).
+				Update("revoked_at", time.Now()).Error
+		}
+		if time.Now().After(record.ExpiresAt) {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Model(&record).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.First(&user, record.UserID).Error
+	})
+	if err != nil || reused {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println()
+			log.Printf("Refresh token error\n")
+			log.Printf("error: %s\n", err.Error())
+			log.Println()
+			ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+				"error": "刷新token失败",
+			})
+			return
+		}
+		ctx.IndentedJSON(http.StatusUnauthorized, gin.H{
+			"error": "登录已失效，请重新登录",
+		})
+		return
+	}
+	issueTokens(ctx, &user)
+}
+
+// UserLogout 作废 refresh token，access token 到期后自然失效
+func UserLogout(ctx *gin.Context) {
+	var input struct {
+		RefreshToken string `binding:"required"`
+	}
+	if ok := BindJSON(ctx, &input); !ok {
+		return
+	}
+	if err := global.DB.Model(&RefreshToken{}).
+		Where("token_hash = ? AND revoked_at IS NULL", HashRefreshToken(input.RefreshToken)).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		log.Println()
+		log.Printf("Revoke refresh token error\n")
+		log.Printf("error: %s\n", err.Error())
+		log.Println()
+		ctx.IndentedJSON(http.StatusInternalServerError, gin.H{
+			"error": "退出登录失败",
+		})
+		return
+	}
+	ctx.IndentedJSON(http.StatusNoContent, nil)
+}
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// refreshTokenRows 查询 refresh_tokens 表时返回的记录
+func refreshTokenRows(tokens ...RefreshToken) fakeResult {
+	rows := make([][]driver.Value, 0, len(tokens))
+	for _, token := range tokens {
+		var revokedAt driver.Value
+		if token.RevokedAt != nil {
+			revokedAt = *token.RevokedAt
+		}
+		rows = append(rows, []driver.Value{
+			int64(token.ID), int64(token.UserID), token.TokenHash, token.ExpiresAt, revokedAt, token.CreatedAt,
+		})
+	}
+	return fakeResult{
+		match:   "FROM `refresh_tokens`",
+		columns: []string{"id", "user_id", "token_hash", "expires_at", "revoked_at", "created_at"},
+		rows:    rows,
+	}
+}
+
+// postRefresh 用 refresh token 调用 RefreshUserToken
+func postRefresh(refreshToken string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.POST("/user/refresh", RefreshUserToken)
+	body := `{"RefreshToken": "` + refreshToken + `"}`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/user/refresh", strings.NewReader(body)))
+	return w
+}
+
+func TestRefreshUserToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	useJWTKey(t)
+	now := time.Now()
+	revokedAt := now.Add(-time.Minute)
+	waiter := User{ID: 7, Username: "waiter", Role: RoleWaiter}
+	const oldToken = "old-refresh-token"
+
+	t.Run("轮换", func(t *testing.T) {
+		db := useFakeDB(t, refreshTokenRows(RefreshToken{
+			ID: 3, UserID: 7, TokenHash: HashRefreshToken(oldToken), ExpiresAt: now.Add(time.Hour),
+		}), userRows(waiter))
+		w := postRefresh(oldToken)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200, body %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		if resp.Token == "" || resp.RefreshToken == "" || resp.RefreshToken == oldToken {
+			t.Errorf("response = %+v, want a new access token and refresh token", resp)
+		}
+		// 旧 token 作废，新 token 只保存哈希
+		if revoked := db.Executed("UPDATE `refresh_tokens` SET `revoked_at`=? WHERE `id` = ?"); len(revoked) != 1 || revoked[0].Args[1] != int64(3) {
+			t.Errorf("revoke statements = %+v, want the old token revoked", revoked)
+		}
+		inserts := db.Executed("INSERT INTO `refresh_tokens`")
+		if len(inserts) != 1 || !containsArg(inserts[0].Args, HashRefreshToken(resp.RefreshToken)) {
+			t.Errorf("insert statements = %+v, want the new token hash", inserts)
+		}
+		if db.rollbacks != 0 {
+			t.Errorf("rollbacks = %d, want 0", db.rollbacks)
+		}
+	})
+
+	t.Run("旧 token 被再次使用时作废该用户所有 token", func(t *testing.T) {
+		db := useFakeDB(t, refreshTokenRows(RefreshToken{
+			ID: 3, UserID: 7, TokenHash: HashRefreshToken(oldToken), ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt,
+		}), userRows(waiter))
+		w := postRefresh(oldToken)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401, body %s", w.Code, w.Body.String())
+		}
+		revoked := db.Executed("WHERE user_id = ? AND revoked_at IS NULL")
+		if len(revoked) != 1 || revoked[0].Args[1] != int64(7) {
+			t.Errorf("revoke statements = %+v, want all tokens of user 7 revoked", revoked)
+		}
+		// 作废必须提交，不能随 401 一起回滚
+		if db.commits != 1 || db.rollbacks != 0 {
+			t.Errorf("commits = %d, rollbacks = %d; want 1, 0", db.commits, db.rollbacks)
+		}
+		if inserts := db.Executed("INSERT INTO `refresh_tokens`"); len(inserts) != 0 {
+			t.Errorf("issued a new refresh token for a reused token: %+v", inserts)
+		}
+	})
+
+	t.Run("已过期", func(t *testing.T) {
+		db := useFakeDB(t, refreshTokenRows(RefreshToken{
+			ID: 3, UserID: 7, TokenHash: HashRefreshToken(oldToken), ExpiresAt: now.Add(-time.Minute),
+		}), userRows(waiter))
+		if w := postRefresh(oldToken); w.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401, body %s", w.Code, w.Body.String())
+		}
+		if updates := db.Executed("UPDATE `refresh_tokens`"); len(updates) != 0 {
+			t.Errorf("updates = %+v, want none", updates)
+		}
+	})
+
+	t.Run("不存在", func(t *testing.T) {
+		db := useFakeDB(t, refreshTokenRows(), userRows(waiter))
+		if w := postRefresh("unknown"); w.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401, body %s", w.Code, w.Body.String())
+		}
+		if inserts := db.Executed("INSERT INTO `refresh_tokens`"); len(inserts) != 0 {
+			t.Errorf("inserts = %+v, want none", inserts)
+		}
+	})
+}
+
+func containsArg(args []driver.Value, want driver.Value) bool {
+	for _, arg := range args {
+		if arg == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package global
+
+import "time"
+
+// 以下配置由 config 包从 yaml 目录加载，供 controller 等包读取
+
+type TableConfig struct {
+	Secret   string // 桌号二维码签名密钥
+	OrderURL string `mapstructure:"order_url"` // 二维码指向的点餐页面地址
+}
+
+var TABLE_CONFIG = &TableConfig{}
+
+type AuthKeyConfig struct {
+	Kid            string
+	Alg            string // HS256 / RS256 / EdDSA
+	Secret         string // HS256 使用
+	PrivateKeyFile string `mapstructure:"private_key_file"` // RS256 / EdDSA 使用，不配置则只用于校验
+	PublicKeyFile  string `mapstructure:"public_key_file"`
+}
+
+type AuthConfig struct {
+	Issuer     string
+	AccessTTL  time.Duration `mapstructure:"access_ttl"`
+	RefreshTTL time.Duration `mapstructure:"refresh_ttl"`
+	ActiveKid  string        `mapstructure:"active_kid"`
+	Keys       []AuthKeyConfig
+}
+
+var AUTH_CONFIG = &AuthConfig{}
+
+type TaxRateConfig struct {
+	Name       string
+	Rate       int64    // 基点，600 表示 6%
+	Inclusive  bool     // true 表示菜价已含税，税额只做展示；false 表示在菜价之外加收
+	Categories []string // 适用的菜品分类，和 Dishes 都为空时适用于所有菜品
+	Dishes     []uint   // 适用的菜品 ID
+}
+
+type ServiceChargeConfig struct {
+	Name string
+	Rate int64 // 基点，0 表示不收服务费
+}
+
+type PricingConfig struct {
+	Currency      string // ISO 4217 币种代码
+	Rounding      int64  // 应付总额舍入单位（最小货币单位），10 表示舍入到角
+	Taxes         []TaxRateConfig
+	ServiceCharge ServiceChargeConfig `mapstructure:"service_charge"`
+}
+
+var PRICING_CONFIG = &PricingConfig{}
+
+type OrderConfig struct {
+	IdempotencyWindow time.Duration `mapstructure:"idempotency_window"`
+	IdempotencyLease  time.Duration `mapstructure:"idempotency_lease"` // 处理中的幂等键的占用时长
+	PrepTimePerItem   time.Duration `mapstructure:"prep_time_per_item"`
+}
+
+var ORDER_CONFIG = &OrderConfig{}
+
+type HotDishesConfig struct {
+	Window          string        // 默认统计窗口，如 7d、24h
+	Windows         []string      // 允许查询的统计窗口，每个窗口单独缓存，不接受其他时长
+	Limit           int           // 默认返回数量
+	MaxLimit        int           `mapstructure:"max_limit"`
+	HalfLife        time.Duration `mapstructure:"half_life"`        // 销量的衰减半衰期，为 0 时不衰减
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"` // 排行的刷新间隔
+}
+
+type MenuConfig struct {
+	Timezone         string          // 营业所在时区，如 Asia/Shanghai
+	BusinessDayStart string          `mapstructure:"business_day_start"` // 营业日分界 "HH:MM"，每日库存在此时重置
+	HotDishes        HotDishesConfig `mapstructure:"hot_dishes"`
+	Location         *time.Location  `mapstructure:"-"`
+}
+
+var MENU_CONFIG = &MenuConfig{}
+
+type S3Config struct {
+	Endpoint  string // 如 localhost:9000，不含协议
+	Region    string
+	Bucket    string
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+	UseSSL    bool   `mapstructure:"use_ssl"`
+	BaseURL   string `mapstructure:"base_url"` // 对象的公开访问前缀
+}
+
+type UploadConfig struct {
+	Storage    string // local / s3
+	Dir        string // local 存储的目录
+	BaseURL    string `mapstructure:"base_url"`   // local 存储的访问前缀
+	MaxSize    int64  `mapstructure:"max_size"`   // 上传文件大小上限，字节
+	MaxPixels  int    `mapstructure:"max_pixels"` // 图片宽高乘积上限，防止解码超大图片耗尽内存
+	ThumbSize  int    `mapstructure:"thumb_size"` // 缩略图最长边，像素
+	MediumSize int    `mapstructure:"medium_size"`
+	S3         S3Config
+}
+
+var UPLOAD_CONFIG = &UploadConfig{}
+
+type RetentionPolicy struct {
+	Keep    string // 保留时长，如 730d，为空表示永久保留
+	Archive string // 删除前的归档方式：file 写入压缩文件，none 直接删除
+}
+
+type RetentionConfig struct {
+	Interval   time.Duration              // 清理的执行间隔
+	BatchSize  int                        `mapstructure:"batch_size"`  // 每批删除的行数，避免长事务锁表
+	ArchiveDir string                     `mapstructure:"archive_dir"` // 归档文件目录
+	Policies   map[string]RetentionPolicy // 按数据类型配置，见 yaml/retention.yaml
+}
+
+var RETENTION_CONFIG = &RetentionConfig{}
@@ -1,11 +1,23 @@
 package global
 
 import (
+	"example.com/m/v2/storage"
 	"github.com/go-redis/redis"
+	"github.com/golang-jwt/jwt"
 	"gorm.io/gorm"
 )
 
+// JWTKey 一把 JWT 密钥，SignKey 为 nil 时只能用于校验
+type JWTKey struct {
+	Kid       string
+	Method    jwt.SigningMethod
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
 var (
 	DB       *gorm.DB
 	REDIS_DB *redis.Client
+	JWT_KEYS = map[string]*JWTKey{} // kid -> 密钥
+	STORAGE  storage.Storage        // 上传文件的存储
 )
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -43,11 +44,43 @@ func gracefullyQuit(r *gin.Engine) {
 	log.Println("Server exiting")
 }
 
+// rebuildRollups 按原始订单重建营业日范围内的销售汇总表
+func rebuildRollups(args []string) {
+	flags := flag.NewFlagSet("rebuild-rollups", flag.ExitOnError)
+	from := flags.String("from", "", "开始营业日，如 2026-10-01，默认最近 7 天")
+	to := flags.String("to", "", "结束营业日（含），默认今天")
+	flags.Parse(args)
+	start, end, err := controller.ParseDateRange(*from, *to)
+	if err != nil {
+		log.Fatalf("Invalid date range: %v", err)
+	}
+	count, err := controller.RebuildRollups(start, end)
+	if err != nil {
+		log.Fatalf("Rebuild rollups error: %v", err)
+	}
+	log.Printf("Rebuilt rollups from %s to %s, %d orders\n", start, end, count)
+}
+
 func main() {
 	config.InitDB()
 	// config.InitRedis()
 	config.InitModel()
 	config.InitApp()
+	config.InitTable()
+	config.InitAuth()
+	config.InitPricing()
+	config.InitOrder()
+	config.InitMenu()
+	config.InitUpload()
+	config.InitRetention()
+	// ./restaurant_app rebuild-rollups -from 2026-10-01 -to 2026-10-07 重建销售汇总表后退出
+	if len(os.Args) > 1 && os.Args[1] == "rebuild-rollups" {
+		rebuildRollups(os.Args[2:])
+		return
+	}
+	controller.StartHotDishesRefresh()
+	controller.StartRetention()
+	controller.StartRollupWorker()
 	r := controller.SetupRouter()
 
 	gracefullyQuit(r)
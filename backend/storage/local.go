@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local 本地磁盘存储，文件由 gin 以静态文件的方式提供
+type Local struct {
+	Dir     string // 存放目录
+	BaseURL string // 静态文件的访问前缀，如 /uploads
+}
+
+// NewLocal 创建本地存储，目录不存在时自动创建
+func NewLocal(dir string, baseURL string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Local{Dir: dir, BaseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// path 把 key 转换为磁盘路径，拒绝跳出存放目录的 key
+func (local *Local) path(key string) (string, error) {
+	if !fs.ValidPath(key) {
+		return "", errors.New("invalid storage key: " + key)
+	}
+	return filepath.Join(local.Dir, filepath.FromSlash(key)), nil
+}
+
+// Save 先写临时文件再改名，读取的一方不会看到写了一半的文件
+func (local *Local) Save(ctx context.Context, key string, contentType string, data []byte) (string, error) {
+	path, err := local.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return local.BaseURL + "/" + key, nil
+}
+
+func (local *Local) Delete(ctx context.Context, key string) error {
+	path, err := local.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (local *Local) KeyOf(url string) (string, bool) {
+	return keyOf(local.BaseURL, url)
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 兼容的对象存储，如 AWS S3、阿里云 OSS、本地开发用的 MinIO
+type S3 struct {
+	client  *minio.Client
+	bucket  string
+	baseURL string // 对象的公开访问前缀，如 http://localhost:9000/dishes 或 CDN 地址
+}
+
+// NewS3 创建对象存储客户端，不会创建 bucket，bucket 需要提前建好并允许公开读
+func NewS3(endpoint string, accessKey string, secretKey string, region string, bucket string, useSSL bool, baseURL string) (*S3, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+		Region: region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3{client: client, bucket: bucket, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Save 上传对象，key 每次都不同，可以让浏览器和 CDN 长期缓存
+func (s3 *S3) Save(ctx context.Context, key string, contentType string, data []byte) (string, error) {
+	_, err := s3.client.PutObject(ctx, s3.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType:  contentType,
+		CacheControl: "public, max-age=31536000, immutable",
+	})
+	if err != nil {
+		return "", err
+	}
+	return s3.baseURL + "/" + key, nil
+}
+
+func (s3 *S3) Delete(ctx context.Context, key string) error {
+	return s3.client.RemoveObject(ctx, s3.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s3 *S3) KeyOf(url string) (string, bool) {
+	return keyOf(s3.baseURL, url)
+}
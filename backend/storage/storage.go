@@ -0,0 +1,26 @@
+// Package storage 保存上传的文件，默认存放在本地磁盘，也可以使用 S3 兼容的对象存储
+package storage
+
+import (
+	"context"
+	"strings"
+)
+
+// Storage 文件存储，key 形如 "dishes/12/ab34cd-medium.jpg"
+type Storage interface {
+	// Save 保存文件并返回可以公开访问的 URL，相同 key 会被覆盖
+	Save(ctx context.Context, key string, contentType string, data []byte) (string, error)
+	// Delete 删除文件，文件不存在时不报错
+	Delete(ctx context.Context, key string) error
+	// KeyOf 从 Save 返回的 URL 中取出 key，不是本存储的 URL 时返回 false
+	KeyOf(url string) (string, bool)
+}
+
+// keyOf 去掉 URL 前缀得到 key
+func keyOf(baseURL string, url string) (string, bool) {
+	prefix := strings.TrimSuffix(baseURL, "/") + "/"
+	if !strings.HasPrefix(url, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(url, prefix), true
+}
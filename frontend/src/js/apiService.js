@@ -1,27 +1,52 @@
 import { serviceConfig } from './config.js';
 import { ErrorHandler } from './errorHandler.js';
 
+// 扫码进入时 URL 中带有 table_token，保存下来供后续请求使用
+function getTableToken() {
+    const token = new URLSearchParams(window.location.search).get('table_token');
+    if (token) {
+        sessionStorage.setItem('table_token', token);
+        return token;
+    }
+    return sessionStorage.getItem('table_token') || '';
+}
+
+// 本地存储时后端返回的是相对路径，需要补上后端地址
+function imageUrl(url) {
+    return url && url.startsWith('/') ? `${serviceConfig.backend.apiBaseUrl}${url}` : url;
+}
+
 async function handleResponse(response) {
     const data = await response.json().catch(() => ({}));
     if (!response.ok) {
         const errorMessage = data.error || data.message || '请求失败';
-        throw new Error(errorMessage);
+        const error = new Error(errorMessage);
+        error.status = response.status;
+        throw error;
     }
     return data;
 }
 
 export async function fetchMenuData() {
     try {
-        const response = await fetch(`${serviceConfig.backend.apiBaseUrl}/api/get_dishes`);
-        const data = await handleResponse(response);
-        
+        const [dishesResponse, categoriesResponse] = await Promise.all([
+            fetch(`${serviceConfig.backend.apiBaseUrl}/api/get_dishes`),
+            fetch(`${serviceConfig.backend.apiBaseUrl}/api/categories`)
+        ]);
+        const data = await handleResponse(dishesResponse);
+        const categories = await handleResponse(categoriesResponse);
+
+        // 后端已按分类顺序排好菜品，这里按分类名分组，分类的先后沿用后端的顺序
+        const categoryNames = new Map(categories.map(category => [category.ID, category.Name]));
         return data.reduce((acc, item) => {
-            if (!acc[item.Category]) acc[item.Category] = [];
-            acc[item.Category].push({
+            const category = categoryNames.get(item.CategoryID) || '其他';
+            if (!acc[category]) acc[category] = [];
+            acc[category].push({
                 id: item.ID,
                 name: item.Name,
-                price: item.Price,
-                img: item.Img
+                price: item.Price / 100, // 后端以分为单位
+                img: imageUrl(item.ImgThumb || item.Img), // 列表用缩略图
+                soldOut: item.SoldOut || !item.Available
             });
             return acc;
         }, {});
@@ -31,12 +56,32 @@ export async function fetchMenuData() {
     }
 }
 
+// 后端按菜名、拼音和拼音首字母搜索，结果按匹配度和热度排序
+export async function searchDishes(keyword) {
+    try {
+        const params = new URLSearchParams({ q: keyword, page_size: 100 });
+        const response = await fetch(`${serviceConfig.backend.apiBaseUrl}/api/dishes/search?${params}`);
+        const data = await handleResponse(response);
+        return data.dishes.map(item => ({
+            id: item.ID,
+            name: item.Name,
+            price: item.Price / 100,
+            img: imageUrl(item.ImgThumb || item.Img),
+            soldOut: item.SoldOut || !item.Available
+        }));
+    } catch (error) {
+        ErrorHandler.showError(error.message);
+        return [];
+    }
+}
+
 export async function calculateTotalPrice(cartItems) {
     try {
         const response = await fetch(`${serviceConfig.backend.apiBaseUrl}/api/get_total_price`, {
             method: 'POST',
             headers: {
-                'Content-Type': 'application/json'
+                'Content-Type': 'application/json',
+                'X-Table-Token': getTableToken()
             },
             body: JSON.stringify(cartItems.map(item => ({
                 Count: item.quantity,
@@ -45,7 +90,7 @@ export async function calculateTotalPrice(cartItems) {
         });
         
         const data = await handleResponse(response);
-        return data.total_price;
+        return data.Total / 100;
     } catch (error) {
         ErrorHandler.showError(error.message);
         return 0;
@@ -60,9 +105,10 @@ export async function getHotDishes() {
         return data.map(item => ({
             id: item.ID,
             name: item.Name, 
-            price: item.Price,
-            category: item.Category,
-            img: item.Img
+            price: item.Price / 100,
+            categoryId: item.CategoryID,
+            img: imageUrl(item.Img),
+            soldOut: item.SoldOut || !item.Available
         }));
     } catch (error) {
         ErrorHandler.showError(error.message);
@@ -70,12 +116,21 @@ export async function getHotDishes() {
     }
 }
 
+// 同一次下单的重复点击和网络重试使用同一个 Idempotency-Key，后端只会创建一个订单
+// 下单成功或被后端拒绝后再换新的
+let orderIdempotencyKey = null;
+
 export async function submitOrder(cartItems) {
+    if (!orderIdempotencyKey) {
+        orderIdempotencyKey = crypto.randomUUID();
+    }
     try {
         const response = await fetch(`${serviceConfig.backend.apiBaseUrl}/api/submit_order`, {
             method: 'POST',
             headers: {
-                'Content-Type': 'application/json'
+                'Content-Type': 'application/json',
+                'X-Table-Token': getTableToken(),
+                'Idempotency-Key': orderIdempotencyKey
             },
             body: JSON.stringify(cartItems.map(item => ({
                 Count: item.quantity,
@@ -84,10 +139,45 @@ export async function submitOrder(cartItems) {
         });
         
         const data = await handleResponse(response);
+        orderIdempotencyKey = null;
         ErrorHandler.showSuccess(data.msg || '订单提交成功');
         return data;
     } catch (error) {
+        // 网络错误（fetch 本身失败）或上一次提交仍在处理中（409）时保留 key 以便重试
+        if (!(error instanceof TypeError) && error.status !== 409) {
+            orderIdempotencyKey = null;
+        }
         ErrorHandler.showError(error.message);
         throw error;
     }
 }
+
+const ORDER_STATUS_TEXT = {
+    placed: '已下单',
+    accepted: '已接单',
+    cooking: '制作中',
+    served: '已上菜',
+    paid: '已结账',
+    cancelled: '已取消',
+    voided: '已作废'
+};
+
+// 订阅订单进度，进度有变化时回调 onStatus，返回用于关闭连接的函数
+export function watchOrderStatus(orderId, trackingToken, onStatus) {
+    const url = `${serviceConfig.backend.apiBaseUrl}/api/orders/${orderId}/status/stream?token=${encodeURIComponent(trackingToken)}`;
+    const source = new EventSource(url);
+    source.addEventListener('status', (event) => {
+        const data = JSON.parse(event.data);
+        onStatus({
+            orderId: data.OrderID,
+            status: data.Status,
+            statusText: ORDER_STATUS_TEXT[data.Status] || data.Status,
+            queueAhead: data.QueueAhead,
+            estimatedMinutes: data.EstimatedMinutes
+        });
+        if (['paid', 'cancelled', 'voided'].includes(data.Status)) {
+            source.close();
+        }
+    });
+    return () => source.close();
+}
@@ -1,5 +1,5 @@
 import { serviceConfig } from './config.js';
-import { fetchMenuData, submitOrder, getHotDishes } from './apiService.js';
+import { fetchMenuData, submitOrder, getHotDishes, watchOrderStatus, searchDishes } from './apiService.js';
 import { renderCategories, renderMenuItems } from './menuView.js';
 import { CartService, renderCartItems } from './cartService.js';
 import { ErrorHandler } from './errorHandler.js';
@@ -11,6 +11,7 @@ class RestaurantApp {
         this.menuData = {};
         this.hotDishes = null; // 缓存热销菜品
         this.cartService = new CartService();
+        this.stopWatchingOrder = null; // 关闭订单进度推送
         this.initElements();
         this.loginModal = setupLoginModal((username, password) => this.handleLogin(username, password));
     }
@@ -23,7 +24,8 @@ class RestaurantApp {
             searchInput: document.querySelector('.search-bar input'),
             searchBtn: document.querySelector('.search-bar button'),
             cartSummary: document.getElementById('cart-summary'),
-            cartDetails: document.getElementById('cart-details')
+            cartDetails: document.getElementById('cart-details'),
+            orderStatus: document.getElementById('order-status')
         };
     }
 
@@ -170,26 +172,42 @@ class RestaurantApp {
             } else {
                 ErrorHandler.showSuccess('订单提交成功');
             }
+            if (result && result.order_id && result.tracking_token) {
+                this.trackOrder(result.order_id, result.tracking_token);
+            }
         } catch (error) {
             console.error('提交订单失败:', error);
             ErrorHandler.showError(error.message || '提交订单失败');
         }
     }
 
+    // 显示最近一次下单的进度和预计等待时间
+    trackOrder(orderId, trackingToken) {
+        if (this.stopWatchingOrder) {
+            this.stopWatchingOrder();
+        }
+        const statusBar = this.elements.orderStatus;
+        this.stopWatchingOrder = watchOrderStatus(orderId, trackingToken, (progress) => {
+            let text = `订单 #${progress.orderId}：${progress.statusText}`;
+            if (progress.estimatedMinutes > 0) {
+                text += `，前面还有 ${progress.queueAhead} 份，预计约 ${progress.estimatedMinutes} 分钟`;
+            }
+            statusBar.textContent = text;
+            statusBar.classList.add('visible');
+        });
+    }
+
     toggleCartDetails() {
         this.elements.cartDetails.classList.toggle('expanded');
     }
 
     async searchItems() {
-        const keyword = this.elements.searchInput.value.trim().toLowerCase();
+        const keyword = this.elements.searchInput.value.trim();
         if (!keyword) return;
-        
-        const allItems = Object.values(this.menuData).flat();
-        const filteredItems = allItems.filter(item => 
-            item.name.toLowerCase().includes(keyword)
-        );
-        
-        renderMenuItems(filteredItems);
+
+        // 由后端搜索，支持拼音和拼音首字母
+        const items = await searchDishes(keyword);
+        renderMenuItems(items);
     }
 }
 
@@ -42,13 +42,15 @@ export function renderMenuItems(items) {
     
     items.forEach(item => {
         const itemElement = document.createElement('div');
-        itemElement.className = 'menu-item';
+        itemElement.className = item.soldOut ? 'menu-item sold-out' : 'menu-item';
         itemElement.innerHTML = `
             <div class="item-image" style="background-image: url(${item.img || ''})"></div>
             <div class="item-info">
                 <h4>${item.name}</h4>
                 <p>¥${item.price.toFixed(2)}</p>
-                <button class="add-to-cart" data-id="${item.id}">+</button>
+                ${item.soldOut
+                    ? '<span class="sold-out-tag">已售罄</span>'
+                    : `<button class="add-to-cart" data-id="${item.id}">+</button>`}
             </div>
         `;
         menuItemsContainer.appendChild(itemElement);